@@ -0,0 +1,243 @@
+package paulstretch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// FileError is the error of StretchFiles for one of its files.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string { return e.Path + ": " + e.Err.Error() }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// FileErrors is the error returned by StretchFiles when some files could not be stretched, with the error
+// of each of them, in the order of the paths.
+type FileErrors []*FileError
+
+func (e FileErrors) Error() string {
+	if len(e) == 1 {
+		return "paulstretch: " + e[0].Error()
+	}
+	return fmt.Sprintf("paulstretch: %d files failed, first: %v", len(e), e[0])
+}
+
+// errInvalidWAV is returned by StretchFiles for WAV files it cannot read.
+var errInvalidWAV = errors.New("unsupported or invalid WAV file")
+
+// errSameFile is returned by StretchFiles for files that would be overwritten by their stretched audio.
+var errSameFile = errors.New("output file is the input file")
+
+// StretchFiles stretches audio files with a stretch factor and window size, as with NewPaulstretch, and writes
+// the stretched audio of each to a file of the same name in outDir, processing up to concurrency files at once,
+// each with its own Paulstretch, for batches of many files. A concurrency lower than 1 is the number of CPUs.
+//
+// Files with the .wav extension are WAV files of 32-bit float or 16-bit integer PCM samples, of any number of
+// channels, and are stretched to WAV files of the same format. Other files are raw mono streams of little-endian
+// 32-bit floats (f32le), and are stretched to raw streams of the same format. The calls to libpaulstretch of all
+// the files are made from concurrency threads, as with WithSharedWorkers, to avoid exhausting the OS threads.
+//
+// The stretched audio cannot overwrite its own file: a file of outDir that is also in paths, for example if outDir
+// is the directory of the files, fails without being read or modified. StretchFiles stretches all the files, even
+// if some fail, and returns a FileErrors with the error of each file that failed, or nil.
+func StretchFiles(paths []string, outDir string, factor float64, windowSize int, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = stretchFile(path, filepath.Join(outDir, filepath.Base(path)), factor, windowSize, concurrency)
+		}(i, path)
+	}
+	wg.Wait()
+	var fileErrs FileErrors
+	for i, err := range errs {
+		if err != nil {
+			fileErrs = append(fileErrs, &FileError{Path: paths[i], Err: err})
+		}
+	}
+	if fileErrs != nil {
+		return fileErrs
+	}
+	return nil
+}
+
+// stretchFile stretches the file at path to the file at outPath, for StretchFiles.
+func stretchFile(path string, outPath string, factor float64, windowSize int, workers int) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	inInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if outInfo, err := os.Stat(outPath); err == nil && os.SameFile(inInfo, outInfo) {
+		// creating the output would truncate the input before it is read
+		return errSameFile
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	r := bufio.NewReader(in)
+	var samples io.Reader = r
+	var w io.Writer = out
+	var wav *WAVWriter
+	opts := []Option{WithSharedWorkers(workers)}
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		format, sampleRate, channels, size, err := readWAVHeader(r)
+		if err != nil {
+			return err
+		}
+		samples = &wavSampleReader{r: io.LimitReader(r, size), format: format}
+		wav, err = NewWAVWriter(out, sampleRate, channels, format)
+		if err != nil {
+			return err
+		}
+		w = wav
+		opts = append(opts, WithChannels(channels))
+	} else {
+		opts = append(opts, WithByteOrder(binary.LittleEndian))
+	}
+	p := NewPaulstretchWithOptions(factor, windowSize, opts...)
+	defer p.ReleaseBuffers()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(p, samples)
+		if err == nil {
+			err = p.CloseFlush()
+		}
+		p.Close()
+		errCh <- err
+	}()
+	_, err = io.Copy(w, p)
+	p.Close()
+	if inErr := <-errCh; err == nil {
+		err = inErr
+	}
+	if err != nil {
+		return err
+	}
+	if wav != nil {
+		if err := wav.Close(); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// readWAVHeader reads the chunks of a WAV stream up to its samples, and returns their format, sample rate,
+// number of channels, and size in bytes.
+func readWAVHeader(r io.Reader) (format WAVFormat, sampleRate int, channels int, size int64, err error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return 0, 0, 0, 0, errInvalidWAV
+	}
+	hasFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return 0, 0, 0, 0, err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			if chunkSize < 16 {
+				return 0, 0, 0, 0, errInvalidWAV
+			}
+			var fmtChunk [16]byte
+			if _, err := io.ReadFull(r, fmtChunk[:]); err != nil {
+				return 0, 0, 0, 0, err
+			}
+			tag, bits := binary.LittleEndian.Uint16(fmtChunk[0:]), binary.LittleEndian.Uint16(fmtChunk[14:])
+			switch {
+			case tag == 3 && bits == 32:
+				format = WAVFloat32
+			case tag == 1 && bits == 16:
+				format = WAVPCM16
+			default:
+				return 0, 0, 0, 0, errInvalidWAV
+			}
+			channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			if channels == 0 || sampleRate == 0 {
+				return 0, 0, 0, 0, errInvalidWAV
+			}
+			hasFormat = true
+			chunkSize -= 16
+		case "data":
+			if !hasFormat {
+				return 0, 0, 0, 0, errInvalidWAV
+			}
+			return format, sampleRate, channels, chunkSize, nil
+		}
+		// skip the rest of the chunk, padded to an even size
+		if _, err := io.CopyN(io.Discard, r, chunkSize+chunkSize%2); err != nil {
+			return 0, 0, 0, 0, err
+		}
+	}
+}
+
+// wavSampleReader converts the samples of a WAV stream, of a format, to an audio sample stream (native-endian floats).
+type wavSampleReader struct {
+	r      io.Reader
+	format WAVFormat
+	buf    []byte
+}
+
+func (r *wavSampleReader) Read(data []byte) (int, error) {
+	size := 4
+	if r.format == WAVPCM16 {
+		size = 2
+	}
+	n := len(data) / 4 * size
+	if n == 0 {
+		return 0, nil
+	}
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	n, err := io.ReadAtLeast(r.r, r.buf[:n], size)
+	n -= n % size
+	for i := 0; i < n/size; i++ {
+		var v float32
+		if r.format == WAVPCM16 {
+			v = float32(int16(binary.LittleEndian.Uint16(r.buf[i*2:]))) / math.MaxInt16
+		} else {
+			v = math.Float32frombits(binary.LittleEndian.Uint32(r.buf[i*4:]))
+		}
+		nativeOrder.PutUint32(data[i*4:], math.Float32bits(v))
+	}
+	if err == io.ErrUnexpectedEOF {
+		// an incomplete last sample is ignored
+		err = io.EOF
+	}
+	return n / size * 4, err
+}
@@ -0,0 +1,90 @@
+package paulstretch
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestStretchFiles(t *testing.T) {
+	dir := t.TempDir()
+	outDir := t.TempDir()
+	samples := testSamples(2 * 3 * testWindowSize)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	raw := make([]byte, len(b))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint32(raw[i*4:], math.Float32bits(v))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "mono.f32"), raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []WAVFormat{WAVFloat32, WAVPCM16} {
+		f, err := os.Create(filepath.Join(dir, map[WAVFormat]string{WAVFloat32: "float.wav", WAVPCM16: "pcm.wav"}[format]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := NewWAVWriter(f, 44100, 2, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(b)
+		w.Close()
+		f.Close()
+	}
+	paths := []string{
+		filepath.Join(dir, "mono.f32"),
+		filepath.Join(dir, "missing.wav"),
+		filepath.Join(dir, "float.wav"),
+		filepath.Join(dir, "pcm.wav"),
+	}
+	err := StretchFiles(paths, outDir, 2, testWindowSize, 2)
+	var fileErrs FileErrors
+	if !errors.As(err, &fileErrs) || len(fileErrs) != 1 || fileErrs[0].Path != paths[1] || !errors.Is(fileErrs[0], os.ErrNotExist) {
+		t.Fatalf("StretchFiles: got error %v, want an error for %s only", err, paths[1])
+	}
+
+	want := NewPaulstretch(2, testWindowSize).EstimateOutputSamples(int64(len(samples)))
+	if info, err := os.Stat(filepath.Join(outDir, "mono.f32")); err != nil || info.Size() != want*4 {
+		t.Errorf("raw output: got (%v, %v), want %d bytes", info, err, want*4)
+	}
+	for _, c := range []struct {
+		name string
+		size int64
+	}{
+		{"float.wav", 4},
+		{"pcm.wav", 2},
+	} {
+		f, err := os.Open(filepath.Join(outDir, c.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		format, sampleRate, channels, size, err := readWAVHeader(f)
+		f.Close()
+		wantSize := NewPaulstretchWithOptions(2, testWindowSize, WithChannels(2)).EstimateOutputSamples(int64(len(samples))) * c.size
+		if err != nil || sampleRate != 44100 || channels != 2 || size != wantSize {
+			t.Errorf("%s: got (%v, %d Hz, %d channels, %d bytes, %v), want (44100 Hz, 2 channels, %d bytes)", c.name, format, sampleRate, channels, size, err, wantSize)
+		}
+	}
+}
+
+func TestStretchFilesSameDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mono.f32")
+	raw := make([]byte, 4*testWindowSize)
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the output would be the input itself
+	err := StretchFiles([]string{path}, dir, 2, testWindowSize, 1)
+	var fileErrs FileErrors
+	if !errors.As(err, &fileErrs) || len(fileErrs) != 1 || !errors.Is(fileErrs[0], errSameFile) {
+		t.Fatalf("StretchFiles: got error %v, want %v for %s", err, errSameFile, path)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != int64(len(raw)) {
+		t.Errorf("input: got (%v, %v), want %d bytes, unchanged", info, err, len(raw))
+	}
+}
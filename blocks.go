@@ -0,0 +1,78 @@
+package paulstretch
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// WriteBatch writes several blocks of samples to Paulstretch, in order, as if each was written with WriteSamples,
+// for block-based processing with many blocks ready at once: the checks and the registration of the call that
+// WriteSamples makes for each block are made once for all the blocks.
+//
+// WriteBatch returns the number of blocks completely written, and the first error. The block at which an error
+// occurred may be partially written: the samples written are then reported by Stats, and the rest of the block
+// can be written with WriteSamples. Like Write, WriteBatch may block until Read is called enough times.
+func (p *Paulstretch) WriteBatch(blocks [][]float32) (n int, err error) {
+	defer p.canceledErr(&err)
+	if !p.enter() {
+		return 0, ErrClosed
+	}
+	defer p.leave()
+	if p.isClosed() {
+		return 0, ErrClosed
+	}
+	if p.source != nil {
+		return 0, ErrSource
+	}
+	for i, block := range blocks {
+		if len(block) == 0 {
+			continue
+		}
+		b := p.sampleBytes(block)
+		if p.convertsInput() {
+			_, err = p.writeResampled(b)
+		} else {
+			var written int
+			written, err = p.write(b)
+			atomic.AddInt64(&p.stats.bytesWritten, int64(written))
+		}
+		runtime.KeepAlive(block)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(blocks), nil
+}
+
+// ReadBatch fills several blocks with stretched samples, in order, as if each was filled with ReadSamples until
+// full, for block-based processing: the stretched samples available for several blocks are read at once.
+// Like Read, ReadBatch blocks until stretched samples are available for each block.
+//
+// ReadBatch returns the number of blocks filled, and the first error, including EOF once all stretched audio
+// was read. The rest of a block partially filled before an error, typically at the end of the stream,
+// is filled with silence, so that no stretched audio is lost, and the block is counted as filled.
+func (p *Paulstretch) ReadBatch(blocks [][]float32) (int, error) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	for i, block := range blocks {
+		for filled := 0; filled < len(block); {
+			n, err := p.readSamples(block[filled:])
+			filled += n
+			if err != nil {
+				if filled == 0 {
+					return i, err
+				}
+				var silence float32
+				if p.outRange != nil {
+					// silence is the center of the range
+					silence = p.outRange.fromUnit(0)
+				}
+				for j := range block[filled:] {
+					block[filled+j] = silence
+				}
+				return i + 1, err
+			}
+		}
+	}
+	return len(blocks), nil
+}
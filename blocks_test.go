@@ -0,0 +1,136 @@
+package paulstretch
+
+import (
+	"io"
+	"testing"
+)
+
+// splitBlocks splits samples into blocks of size samples, the last one possibly shorter.
+func splitBlocks(samples []float32, size int) [][]float32 {
+	var blocks [][]float32
+	for len(samples) > 0 {
+		n := size
+		if n > len(samples) {
+			n = len(samples)
+		}
+		blocks = append(blocks, samples[:n])
+		samples = samples[n:]
+	}
+	return blocks
+}
+
+func TestBatch(t *testing.T) {
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithChannels(2))
+	for c := range p.ps {
+		p.ps[c].destroy()
+		p.ps[c] = &identityEngine{}
+	}
+	samples := testSamples(3*testWindowSize*2 + 10)
+	blocks := splitBlocks(samples, 300)
+	done := make(chan error, 1)
+	go func() {
+		n, err := p.WriteBatch(blocks)
+		if err == nil && n != len(blocks) {
+			t.Errorf("WriteBatch: got %d blocks written, want %d", n, len(blocks))
+		}
+		if err == nil {
+			err = p.CloseFlush()
+		}
+		done <- err
+	}()
+	// the stretched audio is padded to 4 windows by Flush, and the last block is partially filled
+	out := make([]float32, 4*testWindowSize*2+100)
+	for i := range out {
+		out[i] = 1
+	}
+	outBlocks := splitBlocks(out, 4*testWindowSize*2/3)
+	n, err := p.ReadBatch(outBlocks)
+	if err != io.EOF || n != 4 {
+		t.Fatalf("ReadBatch: got (%d, %v), want (4, EOF)", n, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+	for i, v := range out {
+		want := float32(0)
+		if i < len(samples) {
+			want = samples[i]
+		}
+		if v != want {
+			t.Fatalf("ReadBatch: got sample %d = %v, want %v", i, v, want)
+		}
+	}
+
+	p.Close()
+	if n, err := p.WriteBatch(blocks); n != 0 || err != ErrClosed {
+		t.Errorf("WriteBatch after Close: got (%d, %v), want (0, %v)", n, err, ErrClosed)
+	}
+}
+
+func BenchmarkBatch(b *testing.B) {
+	const blocks, blockSize = 16, 256
+	in := splitBlocks(testSamples(blocks*blockSize), blockSize)
+	b.Run("WriteSamples", func(b *testing.B) {
+		p := NewPaulstretch(2, WindowSizeForDuration(DefaultWindowDuration, 44100))
+		go discardAll(p)
+		defer p.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, block := range in {
+				if _, err := p.WriteSamples(block); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("WriteBatch", func(b *testing.B) {
+		p := NewPaulstretch(2, WindowSizeForDuration(DefaultWindowDuration, 44100))
+		go discardAll(p)
+		defer p.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.WriteBatch(in); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	out := splitBlocks(make([]float32, blocks*blockSize), blockSize)
+	b.Run("ReadSamples", func(b *testing.B) {
+		p := NewPaulstretch(2, WindowSizeForDuration(DefaultWindowDuration, 44100))
+		go feedAll(p)
+		defer p.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, block := range out {
+				for n := 0; n < len(block); {
+					m, err := p.ReadSamples(block[n:])
+					if err != nil {
+						b.Fatal(err)
+					}
+					n += m
+				}
+			}
+		}
+	})
+	b.Run("ReadBatch", func(b *testing.B) {
+		p := NewPaulstretch(2, WindowSizeForDuration(DefaultWindowDuration, 44100))
+		go feedAll(p)
+		defer p.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.ReadBatch(out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// feedAll writes windows of samples to p until it is closed.
+func feedAll(p *Paulstretch) {
+	in := testSamples(p.OptimalWriteBufferSize())
+	for {
+		if _, err := p.WriteSamples(in); err != nil {
+			return
+		}
+	}
+}
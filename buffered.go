@@ -0,0 +1,36 @@
+package paulstretch
+
+import "sync/atomic"
+
+// Buffered returns the number of samples written to Paulstretch that do not yet fill a full window, and wait
+// in its internal buffer to be stretched, once the next samples complete the window or Flush is called.
+//
+// Buffered can be called concurrently with Write and Read, for example for debugging or to compute
+// a precise position in the input; it returns a consistent snapshot.
+func (p *Paulstretch) Buffered() int {
+	return int(atomic.LoadInt64(&p.stats.buffered)) / 4
+}
+
+// Pending returns the number of bytes of stretched audio already produced and waiting to be read,
+// including the windows in the output buffers of WithOutputBuffers.
+//
+// Pending can be called concurrently with Write and Read; it returns a consistent snapshot.
+func (p *Paulstretch) Pending() int {
+	if !p.initialized() {
+		return 0
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	n := int(atomic.LoadInt64(&p.stats.pending))
+	if p.ring != nil {
+		for _, b := range p.ring.queue {
+			n += len(b)
+		}
+	}
+	return n
+}
+
+// setBuffered updates the snapshot of writeOff returned by Buffered.
+func (p *Paulstretch) setBuffered() {
+	atomic.StoreInt64(&p.stats.buffered, int64(p.writeOff))
+}
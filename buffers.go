@@ -0,0 +1,40 @@
+package paulstretch
+
+import "sync/atomic"
+
+// outputRing is a queue of windows of processed stretched audio, used when WithOutputBuffers is set.
+type outputRing struct {
+	size  int      // maximum number of queued windows
+	queue [][]byte // queued windows, oldest first
+	free  [][]byte // buffers for new windows
+}
+
+// pop removes and returns the oldest queued window.
+func (r *outputRing) pop() []byte {
+	b := r.queue[0]
+	n := copy(r.queue, r.queue[1:])
+	r.queue[n] = nil
+	r.queue = r.queue[:n]
+	return b
+}
+
+// fill moves windows of stretched samples from the C instances to the output buffers until they are full,
+// and returns whether the C instances have no more stretched samples. It must be called with the lock held.
+func (p *Paulstretch) fill() bool {
+	for len(p.ring.queue) < p.ring.size {
+		if !p.read(p.outSamples) {
+			return true
+		}
+		var buf []byte
+		if n := len(p.ring.free); n > 0 {
+			buf = p.ring.free[n-1]
+			p.ring.free = p.ring.free[:n-1]
+		}
+		mix := p.dryMix
+		p.dryMix = 0
+		buf = p.output(mix, buf[:0])
+		atomic.AddInt64(&p.stats.produced, int64(len(buf)/4))
+		p.ring.queue = append(p.ring.queue, buf)
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package paulstretch
+
+import "sync/atomic"
+
+// Cancel stops Paulstretch right away, discarding the samples written and the stretched audio not yet read,
+// for example when the user cancels an operation: unlike Close, the stretched audio is not drained, and the calls
+// to Read, Write and Flush, including those currently blocked, return ErrCanceled instead of EOF and ErrClosed.
+//
+// Cancel unblocks the calls in progress, waits for them to return, then returns the buffers of Paulstretch
+// as with ReleaseBuffers and frees its libpaulstretch instances, without waiting for the garbage collector.
+// Paulstretch must not be used anymore afterwards. The functions registered with OnComplete are called
+// with ErrCanceled, unless Paulstretch was already closed with another error, which is then kept.
+func (p *Paulstretch) Cancel() {
+	if !p.initialized() {
+		return
+	}
+	atomic.StoreInt32(&p.canceled, 1)
+	p.CloseWithError(ErrCanceled)
+	p.ReleaseBuffers()
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.destroyed {
+		return
+	}
+	p.destroyed = true
+	for _, ps := range p.ps {
+		ps.destroy()
+	}
+	// the discarded stretched audio will not be read: report the end of the stream right away
+	p.complete()
+}
+
+// canceledErr replaces ErrClosed in *err with ErrCanceled once Paulstretch is canceled.
+func (p *Paulstretch) canceledErr(err *error) {
+	if *err == ErrClosed && atomic.LoadInt32(&p.canceled) != 0 {
+		*err = ErrCanceled
+	}
+}
@@ -0,0 +1,56 @@
+package paulstretch
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCancel(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	for _, blocked := range []string{"Read", "Write"} {
+		p := NewPaulstretch(2, testWindowSize)
+		completed := make(chan error, 1)
+		p.OnComplete(func(err error) {
+			completed <- err
+		})
+		done := make(chan error, 1)
+		go func() {
+			var err error
+			if blocked == "Read" {
+				// blocks since nothing is written
+				_, err = p.Read(make([]byte, 16))
+			} else {
+				// blocks since nothing reads the stretched audio
+				_, err = p.WriteSamples(testSamples(10 * testWindowSize))
+			}
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		p.Cancel()
+		select {
+		case err := <-done:
+			if err != ErrCanceled {
+				t.Errorf("blocked %s after Cancel: got error %v, want %v", blocked, err, ErrCanceled)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("blocked %s did not return after Cancel", blocked)
+		}
+		if err := <-completed; err != ErrCanceled {
+			t.Errorf("OnComplete after Cancel: got error %v, want %v", err, ErrCanceled)
+		}
+		if _, err := p.Read(make([]byte, 16)); err != ErrCanceled {
+			t.Errorf("Read after Cancel: got error %v, want %v", err, ErrCanceled)
+		}
+		if _, err := p.Write(make([]byte, 16)); err != ErrCanceled {
+			t.Errorf("Write after Cancel: got error %v, want %v", err, ErrCanceled)
+		}
+		p.Cancel()
+	}
+	for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+		if i == 100 {
+			t.Fatalf("got %d goroutines after Cancel, want %d", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
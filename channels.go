@@ -0,0 +1,46 @@
+package paulstretch
+
+// Channels returns channels to stream audio through Paulstretch, as an alternative to Write and Read
+// for channel-based audio graphs: buffers of samples sent to in are written to Paulstretch, and buffers
+// of stretched samples are received from out, on goroutines managed by Paulstretch. Sending to in blocks
+// while the stretched audio is not received from out, so backpressure is expressed by the channels blocking,
+// and both channels can be used in a select.
+//
+// Closing in flushes and closes Paulstretch: out is closed once all stretched audio was received. A slice
+// sent to in must not be modified afterwards, since it is written asynchronously. Each slice received from out
+// is newly allocated, of at most OptimalBufferSize samples, and owned by the receiver. The error of a write
+// or read, for example after CloseWithError, cannot be received from the channels: use OnComplete to get it.
+// After an error, the buffers sent to in are discarded, and out is closed.
+//
+// Channels is meant to be called once, instead of calling Write and Read directly.
+func (p *Paulstretch) Channels() (in chan<- []float32, out <-chan []float32) {
+	inCh := make(chan []float32)
+	outCh := make(chan []float32)
+	go func() {
+		var err error
+		for samples := range inCh {
+			if err == nil {
+				_, err = p.WriteSamples(samples)
+			}
+		}
+		if err == nil {
+			p.CloseFlush()
+		} else {
+			p.CloseWithError(err)
+		}
+	}()
+	go func() {
+		defer close(outCh)
+		for {
+			samples := make([]float32, p.OptimalBufferSize())
+			n, err := p.ReadSamples(samples)
+			if n > 0 {
+				outCh <- samples[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return inCh, outCh
+}
@@ -0,0 +1,31 @@
+package paulstretch
+
+import "testing"
+
+func TestChannels(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	samples := testSamples(4*testWindowSize + 11)
+	in, out := p.Channels()
+	go func() {
+		defer close(in)
+		// buffers of several sizes
+		for len(samples) > 0 {
+			n := 37
+			if n > len(samples) {
+				n = len(samples)
+			}
+			in <- samples[:n]
+			samples = samples[n:]
+		}
+	}()
+	got := 0
+	for samples := range out {
+		if len(samples) == 0 || len(samples) > p.OptimalBufferSize() {
+			t.Fatalf("Channels: got a buffer of %d samples, want 1 to %d", len(samples), p.OptimalBufferSize())
+		}
+		got += len(samples)
+	}
+	if want := p.EstimateOutputSamples(4*testWindowSize + 11); int64(got) != want {
+		t.Errorf("Channels: got %d stretched samples, want %d", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+package paulstretch
+
+// OnComplete registers fn to be called once the stream of stretched audio is complete: when Paulstretch is closed
+// and Read (or TryRead) finds that all stretched audio was read, so that an event-driven program is notified
+// of the end of the stream without polling Read.
+//
+// fn is called exactly once, on its own goroutine so that it cannot block the reader, with the error set by
+// CloseWithError, or nil if Paulstretch was closed without an error. If the stream is already complete,
+// fn is called right away. Several functions can be registered, and they are all called.
+func (p *Paulstretch) OnComplete(fn func(err error)) {
+	if fn == nil || !p.initialized() {
+		return
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.completed {
+		go fn(p.closeErr)
+		return
+	}
+	p.onComplete = append(p.onComplete, fn)
+}
+
+// complete calls the functions registered with OnComplete, once all stretched audio was read after Close.
+// It must be called with the lock held.
+func (p *Paulstretch) complete() {
+	if p.completed {
+		return
+	}
+	p.completed = true
+	p.closeTaps()
+	// wake up CloseTimeout
+	p.rwCond.Broadcast()
+	for _, fn := range p.onComplete {
+		go fn(p.closeErr)
+	}
+	p.onComplete = nil
+}
@@ -0,0 +1,45 @@
+package paulstretch
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestOnComplete(t *testing.T) {
+	errInput := errors.New("input error")
+	for _, closeErr := range []error{nil, errInput} {
+		p := NewPaulstretch(2, testWindowSize)
+		done := make(chan error, 3)
+		p.OnComplete(func(err error) { done <- err })
+		go func() {
+			p.WriteSamples(testSamples(2 * testWindowSize))
+			p.Flush()
+			p.CloseWithError(closeErr)
+		}()
+		if _, err := io.Copy(io.Discard, p); err != closeErr {
+			t.Fatalf("Read: got error %v, want %v", err, closeErr)
+		}
+		// a second end of stream does not call the function again
+		p.Read(make([]byte, 4))
+		p.TryRead(make([]byte, 4))
+		// registering after completion calls the function right away
+		p.OnComplete(func(err error) { done <- err })
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-done:
+				if err != closeErr {
+					t.Errorf("OnComplete: got error %v, want %v", err, closeErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("OnComplete: the function was not called")
+			}
+		}
+		select {
+		case <-done:
+			t.Error("OnComplete: the function was called twice")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package paulstretch
+
+import (
+	"net"
+	"time"
+)
+
+// conn is the net.Conn returned by Conn.
+type conn struct {
+	p *Paulstretch
+}
+
+// pipeAddr is the address of both ends of the net.Conn returned by Conn.
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "paulstretch" }
+func (pipeAddr) String() string  { return "paulstretch" }
+
+// Conn returns a net.Conn backed by Paulstretch, for code that expects a net.Conn, such as an audio relay:
+// Write writes audio to be stretched, and Read reads the stretched audio, as with Paulstretch.
+//
+// The deadlines of the net.Conn are those of SetReadDeadline and SetWriteDeadline, exceeded with
+// ErrDeadlineExceeded, which implements net.Error. Closing it closes Paulstretch, like Close. LocalAddr
+// and RemoteAddr return a placeholder address, of network "paulstretch".
+func (p *Paulstretch) Conn() net.Conn {
+	return conn{p: p}
+}
+
+func (c conn) Read(b []byte) (int, error)  { return c.p.Read(b) }
+func (c conn) Write(b []byte) (int, error) { return c.p.Write(b) }
+func (c conn) Close() error                { return c.p.Close() }
+func (c conn) LocalAddr() net.Addr         { return pipeAddr{} }
+func (c conn) RemoteAddr() net.Addr        { return pipeAddr{} }
+
+func (c conn) SetDeadline(t time.Time) error {
+	if err := c.p.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.p.SetWriteDeadline(t)
+}
+
+func (c conn) SetReadDeadline(t time.Time) error  { return c.p.SetReadDeadline(t) }
+func (c conn) SetWriteDeadline(t time.Time) error { return c.p.SetWriteDeadline(t) }
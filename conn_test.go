@@ -0,0 +1,35 @@
+package paulstretch
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestConn(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	c := p.Conn()
+	if c.LocalAddr().Network() != "paulstretch" || c.RemoteAddr().String() != "paulstretch" {
+		t.Errorf("Conn: got addresses %v and %v, want placeholders", c.LocalAddr(), c.RemoteAddr())
+	}
+	c.SetDeadline(time.Now().Add(-time.Second))
+	if _, err := c.Read(make([]byte, 16)); err != ErrDeadlineExceeded {
+		t.Errorf("Read after the deadline: got error %v, want %v", err, ErrDeadlineExceeded)
+	}
+	// blocks since nothing reads the stretched audio
+	if _, err := c.Write(make([]byte, 10*testWindowSize*4)); err != ErrDeadlineExceeded {
+		t.Errorf("Write after the deadline: got error %v, want %v", err, ErrDeadlineExceeded)
+	}
+	c.SetDeadline(time.Time{})
+	go func() {
+		c.Write(make([]byte, testWindowSize*4))
+		c.Close()
+	}()
+	b, err := io.ReadAll(c)
+	if err != nil || len(b) == 0 {
+		t.Errorf("ReadAll: got (%d bytes, %v), want stretched audio", len(b), err)
+	}
+	if _, err := c.Write(make([]byte, 4)); err != ErrClosed {
+		t.Errorf("Write after Close: got error %v, want %v", err, ErrClosed)
+	}
+}
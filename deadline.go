@@ -0,0 +1,126 @@
+package paulstretch
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ErrDeadlineExceeded is returned by Read and Write when their deadline, set with SetReadDeadline and
+// SetWriteDeadline, is exceeded. It implements net.Error and its Timeout method returns true.
+var ErrDeadlineExceeded error = deadlineExceededError{}
+
+type deadlineExceededError struct{}
+
+func (deadlineExceededError) Error() string   { return "paulstretch: i/o timeout" }
+func (deadlineExceededError) Timeout() bool   { return true }
+func (deadlineExceededError) Temporary() bool { return true }
+
+// SetReadDeadline sets the deadline for Read calls, including a currently blocked one.
+//
+// After the deadline is exceeded, Read returns ErrDeadlineExceeded instead of waiting for more stretched
+// audio. Stretched audio that is already available is still returned. A zero t clears the deadline.
+func (p *Paulstretch) SetReadDeadline(t time.Time) error {
+	if !p.initialized() {
+		return ErrClosed
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.readTimer != nil {
+		p.readTimer.Stop()
+		p.readTimer = nil
+	}
+	p.readDeadline = t
+	if !t.IsZero() {
+		p.readTimer = time.AfterFunc(time.Until(t), func() {
+			// wake up Read so that it checks the deadline
+			p.rwCond.L.Lock()
+			p.rwCond.Broadcast()
+			p.rwCond.L.Unlock()
+		})
+	}
+	// let a currently blocked Read check the new deadline
+	p.rwCond.Broadcast()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write and Flush calls, including a currently blocked one.
+//
+// After the deadline is exceeded, Write returns ErrDeadlineExceeded instead of waiting for Read to be
+// called, along with the number of bytes written until then. The bytes that were not written can be written
+// again after the deadline is extended. A zero t clears the deadline.
+func (p *Paulstretch) SetWriteDeadline(t time.Time) error {
+	if !p.initialized() {
+		return ErrClosed
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.writeTimer != nil {
+		p.writeTimer.Stop()
+		p.writeTimer = nil
+	}
+	// let a currently blocked Write check the new deadline
+	close(p.writeWake)
+	p.writeWake = make(chan struct{})
+	p.writeDeadline = t
+	if !t.IsZero() {
+		wake := p.writeWake
+		p.writeTimer = time.AfterFunc(time.Until(t), func() {
+			p.rwCond.L.Lock()
+			if p.writeWake == wake {
+				close(wake)
+				p.writeWake = make(chan struct{})
+			}
+			p.rwCond.L.Unlock()
+		})
+	}
+	return nil
+}
+
+// waitWritePermit waits for a write permit, or for the write deadline to be exceeded. Close closes the channel
+// of the permits to unblock a waiting Write: it then returns ErrClosed, so that nothing is written to the engines.
+//
+// With a source, the window is written from Read, which cannot also read the stretched audio while waiting:
+// it returns errNoPermit instead of waiting.
+func (p *Paulstretch) waitWritePermit() error {
+	if p.source != nil {
+		select {
+		case _, ok := <-p.writePermit:
+			return permitErr(ok)
+		default:
+			return errNoPermit
+		}
+	}
+	stalled := false
+	for {
+		p.rwCond.L.Lock()
+		if !p.writeDeadline.IsZero() && !time.Now().Before(p.writeDeadline) {
+			p.rwCond.L.Unlock()
+			return ErrDeadlineExceeded
+		}
+		wake := p.writeWake
+		p.rwCond.L.Unlock()
+		select {
+		case _, ok := <-p.writePermit:
+			return permitErr(ok)
+		default:
+		}
+		if !stalled {
+			// no permit until Read is called
+			stalled = true
+			atomic.AddInt64(&p.stats.writeStalls, 1)
+		}
+		select {
+		case _, ok := <-p.writePermit:
+			return permitErr(ok)
+		case <-wake:
+		}
+	}
+}
+
+// permitErr returns the error of waitWritePermit once a permit was received, ErrClosed if the channel was closed.
+func permitErr(ok bool) error {
+	if !ok {
+		return ErrClosed
+	}
+	return nil
+}
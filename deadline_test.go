@@ -0,0 +1,49 @@
+package paulstretch
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWriteDeadlineWhileBlocked(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	defer p.Close()
+	done := make(chan error)
+	go func() {
+		// blocks since nothing reads the stretched audio
+		_, err := p.WriteSamples(testSamples(10 * testWindowSize))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	select {
+	case err := <-done:
+		if err, ok := err.(net.Error); !ok || !err.Timeout() {
+			t.Errorf("blocked WriteSamples after SetWriteDeadline: got error %v, want a timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked WriteSamples did not time out after SetWriteDeadline")
+	}
+}
+
+func TestReadDeadlineWhileBlocked(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	defer p.Close()
+	done := make(chan error)
+	go func() {
+		// blocks since nothing is written
+		_, err := p.Read(make([]byte, 16))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	select {
+	case err := <-done:
+		if err != ErrDeadlineExceeded {
+			t.Errorf("blocked Read after SetReadDeadline: got error %v, want %v", err, ErrDeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked Read did not time out after SetReadDeadline")
+	}
+}
@@ -0,0 +1,45 @@
+package paulstretch
+
+// DitherKind is the kind of dither added to stretched samples before they are quantized to integers,
+// by ReadInt24Samples with WithDither, and by WAVWriter with WAVPCM16 and SetDither.
+type DitherKind int
+
+const (
+	// DitherNone quantizes the samples by rounding them, without dither.
+	DitherNone DitherKind = iota
+	// DitherRectangular adds white noise with a rectangular distribution of 1 LSB peak-to-peak.
+	DitherRectangular
+	// DitherTriangular adds white noise with a triangular distribution of 2 LSB peak-to-peak,
+	// which also makes the level of the quantization noise independent of the signal.
+	DitherTriangular
+)
+
+// ditherer generates dither, from a pseudo-random sequence with a fixed seed, so that the dithered output
+// of a stream is deterministic.
+type ditherer struct {
+	kind  DitherKind
+	state uint64
+}
+
+func newDitherer(kind DitherKind) *ditherer {
+	if kind != DitherRectangular && kind != DitherTriangular {
+		return nil
+	}
+	return &ditherer{kind: kind, state: 0x9e3779b97f4a7c15}
+}
+
+// next returns the dither to add to the next sample, in LSB.
+func (d *ditherer) next() float64 {
+	if d.kind == DitherTriangular {
+		return d.uniform() + d.uniform()
+	}
+	return d.uniform()
+}
+
+// uniform returns a pseudo-random number in [-0.5, 0.5), with xorshift64*.
+func (d *ditherer) uniform() float64 {
+	d.state ^= d.state >> 12
+	d.state ^= d.state << 25
+	d.state ^= d.state >> 27
+	return float64((d.state*0x2545f4914f6cdd1d)>>11)/(1<<53) - 0.5
+}
@@ -0,0 +1,91 @@
+package paulstretch
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"unsafe"
+)
+
+// TestDither quantizes a DC offset of a fraction of a LSB to 16 bits: it is lost without dither,
+// and preserved on average with dither.
+func TestDither(t *testing.T) {
+	const dc = 0.3 // LSB
+	samples := make([]float32, 1<<16)
+	for i := range samples {
+		samples[i] = dc / math.MaxInt16
+	}
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	for _, tc := range []struct {
+		kind     DitherKind
+		min, max int16
+	}{
+		{DitherNone, 0, 0},
+		{DitherRectangular, 0, 1},
+		{DitherTriangular, -1, 1},
+	} {
+		var b seekBuffer
+		w, err := NewWAVWriter(&b, 44100, 1, WAVPCM16)
+		if err != nil {
+			t.Fatalf("NewWAVWriter: %v", err)
+		}
+		w.SetDither(tc.kind)
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		pcm := b.data[len(b.data)-len(samples)*2:]
+		sum := 0.0
+		min, max := int16(math.MaxInt16), int16(math.MinInt16)
+		for i := 0; i < len(pcm); i += 2 {
+			s := int16(binary.LittleEndian.Uint16(pcm[i:]))
+			sum += float64(s)
+			if s < min {
+				min = s
+			}
+			if s > max {
+				max = s
+			}
+		}
+		mean := sum / float64(len(samples))
+		if min != tc.min || max != tc.max {
+			t.Errorf("dither %d: got samples in [%d, %d], want [%d, %d]", tc.kind, min, max, tc.min, tc.max)
+		}
+		if want := dc; tc.kind == DitherNone {
+			want = 0
+			if mean != want {
+				t.Errorf("dither %d: got a mean of %v LSB, want %v", tc.kind, mean, want)
+			}
+		} else if math.Abs(mean-want) > 0.02 {
+			t.Errorf("dither %d: got a mean of %v LSB, want %v", tc.kind, mean, want)
+		}
+	}
+
+	// ReadInt24Samples, with a stretch factor of 1 that passes the samples through
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithDither(DitherTriangular))
+	for i := range samples {
+		samples[i] = dc / int24Scale
+	}
+	go func() {
+		p.WriteSamples(samples)
+		p.CloseFlush()
+	}()
+	out := make([]byte, len(samples)*3)
+	n := 0
+	for n < len(samples) {
+		m, err := p.ReadInt24Samples(out[n*3:])
+		if err != nil {
+			t.Fatalf("ReadInt24Samples: %v", err)
+		}
+		n += m
+	}
+	sum := 0.0
+	for i := 0; i < len(out); i += 3 {
+		sum += float64(int32(uint32(out[i])<<8|uint32(out[i+1])<<16|uint32(out[i+2])<<24) >> 8)
+	}
+	if mean := sum / float64(len(samples)); math.Abs(mean-dc) > 0.02 {
+		t.Errorf("ReadInt24Samples: got a mean of %v LSB, want %v", mean, dc)
+	}
+}
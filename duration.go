@@ -0,0 +1,96 @@
+package paulstretch
+
+import (
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+// ReadDuration reads exactly samples samples of stretched audio (interleaved, as with ReadSamples) and writes them
+// to out, then returns, for renders of a fixed length regardless of the length of the input: the stretched audio
+// past samples is left to be read later with Read.
+//
+// If the stretched audio ends before, because Paulstretch is closed and all stretched audio was read, the rest
+// is padded with the sustained texture of the last window written, stretched again as with Freeze, so that a fixed
+// length can be rendered from an input of any length. The padding is not processed by WithFade, WithLimiter,
+// WithDCBlock and WithSeamlessLoop, and is silence after ReleaseBuffers. To sustain the texture before the end
+// of the stream instead, call Freeze when the input runs out.
+//
+// ReadDuration returns nil once samples samples were written, or the first error of Read other than EOF, for example
+// with WithMaxOutputSamples or CloseWithError, or of out.
+func (p *Paulstretch) ReadDuration(out io.Writer, samples int64) error {
+	buf := make([]byte, p.OptimalBufferSize()*4)
+	remaining := samples * 4
+	for remaining > 0 {
+		b := buf
+		if int64(len(b)) > remaining {
+			b = b[:remaining]
+		}
+		n, err := p.Read(b)
+		if n > 0 {
+			if _, err := out.Write(b[:n]); err != nil {
+				return err
+			}
+			remaining -= int64(n)
+		}
+		if err == io.EOF {
+			return p.sustainTo(out, remaining, buf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sustainTo writes remaining bytes of the sustained texture of the last window written to out, once all stretched
+// audio was read, using buf to encode them.
+func (p *Paulstretch) sustainTo(out io.Writer, remaining int64, buf []byte) error {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	for remaining > 0 {
+		buf = p.encode(p.sustain(), buf[:0])
+		if int64(len(buf)) > remaining {
+			buf = buf[:remaining]
+		}
+		atomic.AddInt64(&p.stats.produced, int64(len(buf)/4))
+		p.observe(buf)
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+		remaining -= int64(len(buf))
+	}
+	return nil
+}
+
+// sustain stretches the last window written again, and returns a window of its stretched frames, with the
+// processing of process before the finisher, or silence after ReleaseBuffers. It is called with readMu held, once
+// all stretched audio was read, when the engines are no longer used otherwise.
+func (p *Paulstretch) sustain() []float32 {
+	frames := make([]float32, p.windowSize*p.channels)
+	if !p.enter() {
+		return frames
+	}
+	defer p.leave()
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	for !p.read(p.outSamples) {
+		for c, ps := range p.ps {
+			ps.write(p.last[c])
+		}
+	}
+	for c, channel := range p.outSamples {
+		for i, v := range channel {
+			frames[i*p.channels+c] = v
+		}
+	}
+	if p.pitch != nil {
+		frames = p.pitch.process(frames, nil)
+	}
+	if p.gain != 1 {
+		for i, v := range frames {
+			frames[i] = float32(math.Max(-1, math.Min(1, float64(v*p.gain))))
+		}
+	}
+	return frames
+}
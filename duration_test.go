@@ -0,0 +1,35 @@
+package paulstretch
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+func TestReadDuration(t *testing.T) {
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithChannels(2))
+	for c := range p.ps {
+		p.ps[c].destroy()
+		p.ps[c] = &identityEngine{}
+	}
+	samples := testSamples(2 * testWindowSize * 2)
+	go func() {
+		p.WriteSamples(samples)
+		p.Close()
+	}()
+	window := testWindowSize * 2 * 4
+	// truncated: the rest is read afterwards
+	var out bytes.Buffer
+	if err := p.ReadDuration(&out, testWindowSize+3); err != nil || out.Len() != (testWindowSize+3)*4 {
+		t.Fatalf("ReadDuration: got (%d bytes, %v), want (%d, nil)", out.Len(), err, (testWindowSize+3)*4)
+	}
+	// padded with the last window stretched again
+	if err := p.ReadDuration(&out, int64(4*testWindowSize*2-testWindowSize-3)); err != nil || out.Len() != 4*window {
+		t.Fatalf("ReadDuration: got (%d bytes, %v), want (%d, nil)", out.Len(), err, 4*window)
+	}
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	want := append(append(append([]byte(nil), data...), data[window:]...), data[window:]...)
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Error("ReadDuration: got output different from the written windows followed by the last window")
+	}
+}
@@ -0,0 +1,64 @@
+package paulstretch
+
+import (
+	"io"
+	"unsafe"
+)
+
+// Encoder is an encoder of stretched audio, for example to a compressed format such as FLAC or Ogg, driven
+// by EncodeTo. It is meant to be implemented by wrapping an encoder of a third-party package.
+type Encoder interface {
+	// WriteSamples encodes stretched samples (interleaved, as read with ReadSamples). samples is only valid
+	// during the call.
+	WriteSamples(samples []float32) error
+	// Close finishes the encoded stream, after the last samples.
+	Close() error
+}
+
+// EncodeTo reads all the stretched audio of Paulstretch, and encodes it with enc, then closes enc once Paulstretch
+// is closed and all stretched audio was read. Like Read, it waits for the stretched audio to be written, and is
+// typically called concurrently with the calls to Write, Flush and Close.
+//
+// EncodeTo returns nil once enc is closed, or the first error of Read other than EOF, for example set
+// with CloseWithError, or of enc. enc is closed on an error of Read too, and only its first error is returned.
+func (p *Paulstretch) EncodeTo(enc Encoder) error {
+	samples := make([]float32, p.OptimalBufferSize())
+	for {
+		n, err := p.ReadSamples(samples)
+		if n > 0 {
+			if err := enc.WriteSamples(samples[:n]); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			cerr := enc.Close()
+			if err == io.EOF {
+				return cerr
+			}
+			return err
+		}
+	}
+}
+
+// rawEncoder is the Encoder returned by NewRawEncoder.
+type rawEncoder struct {
+	w io.Writer
+}
+
+// NewRawEncoder returns an Encoder that writes the samples to w as an audio sample stream (native-endian floats),
+// as read from Paulstretch, for example as a reference implementation of Encoder. Its Close does not close w.
+func NewRawEncoder(w io.Writer) Encoder {
+	return rawEncoder{w: w}
+}
+
+func (e rawEncoder) WriteSamples(samples []float32) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	_, err := e.w.Write(unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4))
+	return err
+}
+
+func (e rawEncoder) Close() error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package paulstretch
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+// fakeEncoder is an in-memory Encoder.
+type fakeEncoder struct {
+	samples []float32
+	closed  bool
+	err     error
+}
+
+func (e *fakeEncoder) WriteSamples(samples []float32) error {
+	e.samples = append(e.samples, samples...)
+	return e.err
+}
+
+func (e *fakeEncoder) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestEncodeTo(t *testing.T) {
+	samples := testSamples(3*testWindowSize + 5)
+	p := NewPaulstretch(2, testWindowSize)
+	go func() {
+		p.WriteSamples(samples)
+		p.CloseFlush()
+	}()
+	var enc fakeEncoder
+	if err := p.EncodeTo(&enc); err != nil || !enc.closed {
+		t.Fatalf("EncodeTo: got (%v, closed %v), want (nil, closed true)", err, enc.closed)
+	}
+	if want := p.EstimateOutputSamples(int64(len(samples))); int64(len(enc.samples)) != want {
+		t.Errorf("EncodeTo: got %d samples encoded, want %d", len(enc.samples), want)
+	}
+
+	errEncode := errors.New("encode")
+	p = NewPaulstretch(2, testWindowSize)
+	defer p.Close()
+	go p.WriteSamples(samples)
+	if err := p.EncodeTo(&fakeEncoder{err: errEncode}); err != errEncode {
+		t.Errorf("EncodeTo: got error %v, want %v", err, errEncode)
+	}
+}
+
+func TestRawEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewRawEncoder(&buf)
+	samples := testSamples(10)
+	if err := enc.WriteSamples(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)) {
+		t.Error("RawEncoder: got bytes different from the samples written")
+	}
+}
@@ -0,0 +1,22 @@
+package paulstretch
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// nativeOrder is the native byte order of the platform.
+var nativeOrder binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// swap32 reverses in place the byte order of each 4-byte group in b.
+func swap32(b []byte) {
+	for i := 0; i+4 <= len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+}
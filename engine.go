@@ -0,0 +1,41 @@
+package paulstretch
+
+// engine stretches the samples of a single channel, one window at a time: it is implemented by
+// libpaulstretch with cgo, and by a pure Go implementation of the algorithm otherwise.
+type engine interface {
+	// write writes a window of samples to stretch.
+	write(samples []float32)
+	// read returns the next window of stretched samples, valid until the next call, and whether it was available.
+	read() ([]float32, bool)
+	// latency returns the delay, in samples of output, between the stretched position of a sample of input
+	// and the center of its stretched audio.
+	latency() int
+	// destroy frees the resources of the engine, which must not be used anymore.
+	destroy()
+}
+
+// passEngine is an engine that passes each window through unchanged, used for a stretch factor of 1: stretching
+// by 1 would only randomize the phases of each window, which smears the audio without stretching it.
+type passEngine struct {
+	window []float32
+	ok     bool
+}
+
+func newPassEngine(windowSize int) *passEngine {
+	return &passEngine{window: make([]float32, windowSize)}
+}
+
+func (e *passEngine) write(samples []float32) {
+	copy(e.window, samples)
+	e.ok = true
+}
+
+func (e *passEngine) read() ([]float32, bool) {
+	ok := e.ok
+	e.ok = false
+	return e.window, ok
+}
+
+func (e *passEngine) latency() int { return 0 }
+
+func (e *passEngine) destroy() {}
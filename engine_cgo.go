@@ -0,0 +1,56 @@
+//go:build cgo
+// +build cgo
+
+package paulstretch
+
+// #cgo pkg-config: paulstretch
+// #include <paulstretch.h>
+import "C"
+import "unsafe"
+
+// newEngine returns an engine using libpaulstretch.
+func newEngine(stretchFactor float64, windowSize int) engine {
+	return newCEngine(stretchFactor, windowSize)
+}
+
+// engineMemory returns the approximate memory held by an engine of a window size, in bytes: the native buffers
+// of a libpaulstretch instance, for its input and output samples and the FFT of a window, about 8 windows of floats.
+func engineMemory(windowSize int) int64 {
+	return 8 * 4 * int64(windowSize)
+}
+
+// cEngine is an engine using a libpaulstretch instance.
+type cEngine struct {
+	ps         C.paulstretch
+	windowSize int
+	out        *C.float // output of paulstretch_read, a field so that it does not escape to the heap on each call
+}
+
+func newCEngine(stretchFactor float64, windowSize int) *cEngine {
+	return &cEngine{
+		ps:         C.paulstretch_create(C.double(stretchFactor), C.size_t(windowSize)),
+		windowSize: windowSize,
+	}
+}
+
+func (e *cEngine) write(samples []float32) {
+	C.paulstretch_write(e.ps, (*C.float)(unsafe.Pointer(&samples[0])))
+}
+
+func (e *cEngine) read() ([]float32, bool) {
+	if !C.paulstretch_read(e.ps, &e.out) {
+		return nil, false
+	}
+	// paulstretch_read always outputs a whole window, since the last window written is padded by Flush:
+	// the samples are owned by the C instance, until its next call
+	return unsafe.Slice((*float32)(unsafe.Pointer(e.out)), e.windowSize), true
+}
+
+func (e *cEngine) latency() int {
+	// the stretched audio of each window is output in windows of the same size, centered on their middle
+	return e.windowSize / 2
+}
+
+func (e *cEngine) destroy() {
+	C.paulstretch_destroy(e.ps)
+}
@@ -0,0 +1,48 @@
+//go:build cgo
+// +build cgo
+
+package paulstretch
+
+import (
+	"math"
+	"testing"
+)
+
+// TestEngines cross-validates the pure Go engine against libpaulstretch on a sine sweep: since the phases
+// of the stretched audio are random, they are compared on the length and level of their output.
+func TestEngines(t *testing.T) {
+	const windows = 32
+	sweep := make([]float32, windows*testWindowSize)
+	for i := range sweep {
+		// from 0.01 to 0.2 cycles per sample
+		x := float64(i) / float64(len(sweep))
+		sweep[i] = float32(0.5 * math.Sin(2*math.Pi*float64(i)*(0.01+0.095*x)))
+	}
+	for _, factor := range []float64{1, 3} {
+		stretch := func(e engine) (samples int, rms float64) {
+			defer e.destroy()
+			for i := 0; i < windows; i++ {
+				e.write(sweep[i*testWindowSize:])
+				for {
+					out, ok := e.read()
+					if !ok {
+						break
+					}
+					for _, v := range out {
+						rms += float64(v) * float64(v)
+					}
+					samples += len(out)
+				}
+			}
+			return samples, math.Sqrt(rms / float64(samples))
+		}
+		cSamples, cRMS := stretch(newCEngine(factor, testWindowSize))
+		goSamples, goRMS := stretch(newGoEngine(factor, testWindowSize))
+		if d := cSamples - goSamples; d < -int(factor+1)*testWindowSize || d > int(factor+1)*testWindowSize {
+			t.Errorf("factor %v: got %d samples with Go, want about %d as with libpaulstretch", factor, goSamples, cSamples)
+		}
+		if goRMS < cRMS/2 || goRMS > cRMS*2 {
+			t.Errorf("factor %v: got RMS %v with Go, want about %v as with libpaulstretch", factor, goRMS, cRMS)
+		}
+	}
+}
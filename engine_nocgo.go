@@ -0,0 +1,16 @@
+//go:build !cgo
+// +build !cgo
+
+package paulstretch
+
+// newEngine returns an engine using the pure Go implementation, since cgo is disabled.
+func newEngine(stretchFactor float64, windowSize int) engine {
+	return newGoEngine(stretchFactor, windowSize)
+}
+
+// engineMemory returns the approximate memory held by an engine of a window size, in bytes: the buffers
+// of the pure Go implementation, for its window, its FFT, and its input and output samples, about 10 windows
+// of float64 values.
+func engineMemory(windowSize int) int64 {
+	return 10 * 8 * int64(windowSize)
+}
@@ -0,0 +1,126 @@
+package paulstretch
+
+import (
+	"sort"
+	"sync"
+)
+
+// maxEnvelopeFactor is the maximum local stretch factor of a stretch envelope.
+const maxEnvelopeFactor = 1e6
+
+// stretchEnvelope follows a time-varying stretch factor by submitting each window of input several times
+// to C instances created with a stretch factor of 1.
+type stretchEnvelope struct {
+	fn      func(inputSample int64) float64
+	pos     int64   // input position of the next window, in frames
+	credit  float64 // fraction of a window carried over to the next window
+	pending int     // number of times the current window is still to be submitted
+
+	mu      sync.Mutex      // guards changes, queued concurrently with Write
+	changes []stretchChange // changes queued with QueueStretchChange, in order
+	factor  float64         // stretch factor of the last change applied, 0 if none, which replaces fn
+	// windows of output before each window of input, and in total, for InputPositionForOutput, guarded by mu:
+	// the input window i is repeated outWindows[i+1]-outWindows[i] times
+	outWindows []int64
+	total      int64
+}
+
+// stretchChange is a change of stretch factor queued with QueueStretchChange.
+type stretchChange struct {
+	at     int64 // input position, in frames
+	factor float64
+}
+
+// next returns the number of times the next window of input is to be submitted, which is at least 1,
+// and advances the envelope to the following window.
+func (e *stretchEnvelope) next(windowSize int) int {
+	e.mu.Lock()
+	for len(e.changes) > 0 && e.changes[0].at <= e.pos {
+		e.factor = e.changes[0].factor
+		e.changes = e.changes[1:]
+	}
+	f := e.factor
+	e.mu.Unlock()
+	if f == 0 {
+		f = e.fn(e.pos)
+	}
+	if !(f >= 1) {
+		f = 1
+	} else if f > maxEnvelopeFactor {
+		f = maxEnvelopeFactor
+	}
+	e.pos += int64(windowSize)
+	e.credit += f
+	n := int(e.credit)
+	e.credit -= float64(n)
+	e.mu.Lock()
+	e.outWindows = append(e.outWindows, e.total)
+	e.total += int64(n)
+	e.mu.Unlock()
+	return n
+}
+
+// outputPosition returns the output position, in windows, of the input position in, in frames of windows
+// of windowSize frames, and whether the window of input at in was written already, so that its repeats are known.
+func (e *stretchEnvelope) outputPosition(in float64, windowSize int) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	i := int(in / float64(windowSize))
+	if i >= len(e.outWindows) {
+		return 0, false
+	}
+	end := e.total
+	if i+1 < len(e.outWindows) {
+		end = e.outWindows[i+1]
+	}
+	frac := in/float64(windowSize) - float64(i)
+	return float64(e.outWindows[i]) + frac*float64(end-e.outWindows[i]), true
+}
+
+// inputPosition returns the input position, in frames of windows of windowSize frames, of the output position out,
+// in windows: the matching position in the window of input repeated at out, interpolated over its repeats.
+func (e *stretchEnvelope) inputPosition(out float64, windowSize int) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.outWindows) == 0 || out <= 0 {
+		return 0
+	}
+	if out >= float64(e.total) {
+		return float64(len(e.outWindows) * windowSize)
+	}
+	// the last input window starting at or before out
+	i := sort.Search(len(e.outWindows), func(i int) bool { return float64(e.outWindows[i]) > out }) - 1
+	end := e.total
+	if i+1 < len(e.outWindows) {
+		end = e.outWindows[i+1]
+	}
+	frac := (out - float64(e.outWindows[i])) / float64(end-e.outWindows[i])
+	return (float64(i) + frac) * float64(windowSize)
+}
+
+// QueueStretchChange schedules a change of the stretch factor to factor, once the input reaches atInputSample,
+// in frames (samples per channel) since the first sample written to Paulstretch, for automation such as
+// a stretch of 2 for the first 5 seconds, then 10, without a stretch envelope callback.
+//
+// The change takes effect at the first window of input starting at or after atInputSample, and replaces
+// the stretch factor from then on, including the stretch envelope of WithStretchEnvelope. Changes are applied
+// in the order they were queued: a change queued at a position before that of a previous change takes effect
+// together with it, and replaces it. The factor is clamped as with WithStretchEnvelope.
+//
+// Since libpaulstretch uses a constant stretch factor, a varying stretch factor requires Paulstretch to be created
+// with WithStretchChanges or WithStretchEnvelope: QueueStretchChange otherwise returns ErrFixedStretchFactor.
+func (p *Paulstretch) QueueStretchChange(atInputSample int64, factor float64) error {
+	if !p.initialized() {
+		return ErrClosed
+	}
+	if p.envelope == nil {
+		return ErrFixedStretchFactor
+	}
+	if !(factor >= 1) {
+		factor = 1
+	}
+	p.envelope.mu.Lock()
+	p.envelope.changes = append(p.envelope.changes, stretchChange{at: atInputSample, factor: factor})
+	p.envelope.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,57 @@
+package paulstretch
+
+import "errors"
+
+// ErrClosed is returned by Write and Flush when Paulstretch is closed, by Close or ReleaseBuffers.
+//
+// Read still returns EOF once Paulstretch is closed and all stretched audio was read, as expected
+// from an io.Reader.
+var ErrClosed = errors.New("paulstretch: closed")
+
+// ErrInvalidStretchFactor is returned by NewPaulstretchChecked when the stretch factor is less than 1.0 or is not finite.
+var ErrInvalidStretchFactor = errors.New("paulstretch: invalid stretch factor")
+
+// ErrInvalidWindowSize is returned by NewPaulstretchChecked when the window size is less than 128.
+var ErrInvalidWindowSize = errors.New("paulstretch: invalid window size")
+
+// ErrInvalidWindow is returned by ProcessWindow when its input is not exactly a window of samples.
+var ErrInvalidWindow = errors.New("paulstretch: invalid window")
+
+// ErrSource is returned by Write and Flush when a source is set with SetSource.
+var ErrSource = errors.New("paulstretch: Paulstretch has a source")
+
+// ErrOutputLimitExceeded is returned by Read once the limit of stretched samples set with WithMaxOutputSamples was read.
+var ErrOutputLimitExceeded = errors.New("paulstretch: output limit exceeded")
+
+// ErrNotSeekable is returned by NewWAVWriter when its writer cannot seek.
+var ErrNotSeekable = errors.New("paulstretch: writer not seekable")
+
+// ErrNotClosed is returned by ReadAllAfterClose when Paulstretch is not closed yet.
+var ErrNotClosed = errors.New("paulstretch: not closed")
+
+// ErrInvalidInt24 is returned by WriteInt24Samples and ReadInt24Samples when the length of their packed 24-bit
+// samples is not a multiple of 3.
+var ErrInvalidInt24 = errors.New("paulstretch: invalid 24-bit samples")
+
+// ErrFixedStretchFactor is returned by QueueStretchChange when Paulstretch was created without WithStretchChanges
+// or WithStretchEnvelope, so that its stretch factor cannot change.
+var ErrFixedStretchFactor = errors.New("paulstretch: fixed stretch factor")
+
+// ErrNotAligned is returned by WriteAligned when its samples are not exactly a window, or when samples written
+// before with Write do not yet fill a window.
+var ErrNotAligned = errors.New("paulstretch: samples not aligned to a window")
+
+// ErrCanceled is returned by Read, Write and Flush once Paulstretch is canceled with Cancel.
+var ErrCanceled = errors.New("paulstretch: canceled")
+
+// ErrAlreadyWritten is returned by Prime when samples were already written to Paulstretch.
+var ErrAlreadyWritten = errors.New("paulstretch: samples already written")
+
+// ErrNoLookahead is returned by SetLookahead when Paulstretch has no look-ahead to adjust, without WithLimiter.
+var ErrNoLookahead = errors.New("paulstretch: no look-ahead")
+
+// ErrInvalidLookahead is returned by SetLookahead when its look-ahead is out of range.
+var ErrInvalidLookahead = errors.New("paulstretch: invalid look-ahead")
+
+// errNoPermit is returned by waitWritePermit instead of blocking when a source is set.
+var errNoPermit = errors.New("paulstretch: no write permit")
@@ -2,7 +2,6 @@ package main
 
 import (
 	"flag"
-	"io"
 	"os"
 
 	"github.com/delthas/go-paulstretch"
@@ -21,12 +20,9 @@ func main() {
 	// stretch the audio ten times
 	stretchFactor := 10.0
 
-	// a good default buffer_duration for most music is 0.25 seconds
-	bufferDuration := 0.25
-	// multiply by the sample rate to get the buffer size in samples
-	windowSize := int(bufferDuration * 44100)
-
-	ps := paulstretch.NewPaulstretch(stretchFactor, windowSize)
+	// a good default window duration for most music is 0.25 seconds
+	// convert it to a window size in samples, for audio at 44100 Hz
+	windowSize := paulstretch.WindowSizeForDuration(paulstretch.DefaultWindowDuration, 44100)
 
 	// for this example we use raw files because using audio codecs is not relevant
 	// to generate the input file: `ffmpeg -i input.file -f f32le -c:a pcm_f32le input.raw`
@@ -45,16 +41,7 @@ func main() {
 	}
 	defer out.Close()
 
-	go func() {
-		_, err := io.Copy(ps, in)
-		ps.Close()
-		if err != nil {
-			panic(err)
-		}
-	}()
-
-	_, err = io.Copy(out, ps)
-	if err != nil {
+	if err := paulstretch.StretchStream(in, out, stretchFactor, windowSize); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,40 @@
+package paulstretch_test
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/delthas/go-paulstretch"
+)
+
+func ExampleMultiStretch() {
+	in, err := os.Open("input.raw")
+	if err != nil {
+		panic(err)
+	}
+	defer in.Close()
+
+	windowSize := paulstretch.WindowSizeForDuration(paulstretch.DefaultWindowDuration, 44100)
+	readers, err := paulstretch.MultiStretch(in, windowSize, []float64{2, 5, 20})
+	if err != nil {
+		panic(err)
+	}
+
+	var wg sync.WaitGroup
+	for i, r := range readers {
+		wg.Add(1)
+		go func(i int, r io.Reader) {
+			defer wg.Done()
+			// close each reader when done, so that a reader that stops early does not block the others
+			defer r.(io.Closer).Close()
+			out, err := os.Create([]string{"x2.raw", "x5.raw", "x20.raw"}[i])
+			if err != nil {
+				return
+			}
+			defer out.Close()
+			io.Copy(out, r)
+		}(i, r)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package paulstretch
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// fft computes discrete Fourier transforms of a fixed size, with a mixed-radix Cooley-Tukey algorithm.
+//
+// It is fastest for sizes whose only prime factors are small, such as the window sizes of WindowSizeForDuration,
+// and falls back to a direct transform for the large prime factors of other sizes.
+type fft struct {
+	n       int
+	twiddle []complex128 // twiddle[j] is exp(-2πij/n)
+	scratch []complex128 // input of the out-of-place transform
+	sums    []complex128 // terms of a butterfly, of the size of the largest prime factor of n
+}
+
+func newFFT(n int) *fft {
+	f := &fft{
+		n:       n,
+		twiddle: make([]complex128, n),
+		scratch: make([]complex128, n),
+	}
+	for j := range f.twiddle {
+		f.twiddle[j] = cmplx.Rect(1, -2*math.Pi*float64(j)/float64(n))
+	}
+	largest := 1
+	for m := n; m > 1; m /= smallestFactor(m) {
+		if p := smallestFactor(m); p > largest {
+			largest = p
+		}
+	}
+	f.sums = make([]complex128, largest)
+	return f
+}
+
+// transform replaces x, of size n, with its discrete Fourier transform.
+func (f *fft) transform(x []complex128) {
+	copy(f.scratch, x)
+	f.recurse(x, f.scratch, f.n, 1)
+}
+
+// inverse replaces x, of size n, with its inverse discrete Fourier transform.
+func (f *fft) inverse(x []complex128) {
+	for i, v := range x {
+		x[i] = cmplx.Conj(v)
+	}
+	f.transform(x)
+	scale := 1 / float64(f.n)
+	for i, v := range x {
+		x[i] = complex(real(v)*scale, -imag(v)*scale)
+	}
+}
+
+// recurse writes to out the transform of the n values of in spaced by stride.
+func (f *fft) recurse(out, in []complex128, n, stride int) {
+	if n == 1 {
+		out[0] = in[0]
+		return
+	}
+	p := smallestFactor(n)
+	m := n / p
+	// transform the p interleaved subsequences of m values into consecutive blocks of out
+	for r := 0; r < p; r++ {
+		f.recurse(out[r*m:(r+1)*m], in[r*stride:], m, stride*p)
+	}
+	// exp(-2πij/n) is twiddle[j*s]
+	s := f.n / n
+	for k := 0; k < m; k++ {
+		for r := 0; r < p; r++ {
+			f.sums[r] = out[r*m+k] * f.twiddle[r*k*s]
+		}
+		for q := 0; q < p; q++ {
+			var sum complex128
+			for r := 0; r < p; r++ {
+				sum += f.sums[r] * f.twiddle[(r*q*m*s)%f.n]
+			}
+			out[q*m+k] = sum
+		}
+	}
+}
+
+// smallestFactor returns the smallest prime factor of n, which must be greater than 1.
+func smallestFactor(n int) int {
+	for p := 2; p*p <= n; p++ {
+		if n%p == 0 {
+			return p
+		}
+	}
+	return n
+}
@@ -0,0 +1,37 @@
+package paulstretch
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestFFT(t *testing.T) {
+	// sizes with small and large prime factors, and a prime size
+	for _, n := range []int{1, 2, 8, 12, 45, 128, 135, 2 * 97, 101} {
+		x := make([]complex128, n)
+		for i := range x {
+			x[i] = complex(math.Sin(float64(i)*0.3), math.Cos(float64(i*i)*0.1))
+		}
+		y := append([]complex128(nil), x...)
+		f := newFFT(n)
+		f.transform(y)
+		for k := range y {
+			var want complex128
+			for j, v := range x {
+				want += v * cmplx.Rect(1, -2*math.Pi*float64(j*k)/float64(n))
+			}
+			if cmplx.Abs(y[k]-want) > 1e-9*float64(n) {
+				t.Errorf("size %d: got X[%d] = %v, want %v", n, k, y[k], want)
+				break
+			}
+		}
+		f.inverse(y)
+		for i := range y {
+			if cmplx.Abs(y[i]-x[i]) > 1e-9 {
+				t.Errorf("size %d: inverse: got x[%d] = %v, want %v", n, i, y[i], x[i])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package paulstretch
+
+import (
+	"io"
+	"os"
+)
+
+// ReadFromFile writes the audio sample stream read from f, from its current offset to its end, to Paulstretch,
+// flushes it as with Flush, and returns the number of bytes written.
+//
+// On platforms that support it, a regular file is memory-mapped, and its windows of samples are passed to
+// libpaulstretch straight from the mapped memory, which avoids the allocation and copies of io.Copy.
+// Otherwise, for example for pipes, ReadFromFile falls back to io.Copy. The end of the file that does not fill
+// a full window is padded by Flush. The offset of f is moved to the end of the samples written.
+func (p *Paulstretch) ReadFromFile(f *os.File) (int64, error) {
+	n, err := p.readFromFile(f)
+	if err != nil {
+		return n, err
+	}
+	return n, p.Flush()
+}
+
+// copyFile writes the samples read from f to p with io.Copy, when f cannot be memory-mapped.
+func (p *Paulstretch) copyFile(f *os.File) (int64, error) {
+	return io.Copy(p, f)
+}
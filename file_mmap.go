@@ -0,0 +1,32 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package paulstretch
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// readFromFile writes the samples of f to p from a memory mapping of f, if f is a regular file.
+func (p *Paulstretch) readFromFile(f *os.File) (int64, error) {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return p.copyFile(f)
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() <= offset || int64(int(info.Size())) != info.Size() {
+		return p.copyFile(f)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return p.copyFile(f)
+	}
+	defer syscall.Munmap(data)
+	n, err := p.Write(data[offset:])
+	if _, serr := f.Seek(offset+int64(n), io.SeekStart); err == nil {
+		err = serr
+	}
+	return int64(n), err
+}
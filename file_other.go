@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package paulstretch
+
+import "os"
+
+// readFromFile writes the samples of f to p: memory mappings are not supported on this platform.
+func (p *Paulstretch) readFromFile(f *os.File) (int64, error) {
+	return p.copyFile(f)
+}
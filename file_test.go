@@ -0,0 +1,42 @@
+package paulstretch
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestReadFromFile(t *testing.T) {
+	samples := testSamples(3*testWindowSize + 50)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	path := filepath.Join(t.TempDir(), "input.raw")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int64{0, 40} {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		p := NewPaulstretch(1, testWindowSize)
+		go io.Copy(io.Discard, p)
+		n, err := p.ReadFromFile(f)
+		if n != int64(len(b))-offset || err != nil {
+			t.Errorf("offset %d: ReadFromFile: got (%d, %v), want (%d, nil)", offset, n, err, int64(len(b))-offset)
+		}
+		// the end of the file was flushed
+		if windows := p.Stats().WindowsProcessed; windows != 4 {
+			t.Errorf("offset %d: ReadFromFile: got %d windows processed, want 4", offset, windows)
+		}
+		if pos, _ := f.Seek(0, io.SeekCurrent); pos != int64(len(b)) {
+			t.Errorf("offset %d: ReadFromFile: got file offset %d, want %d", offset, pos, len(b))
+		}
+		p.Close()
+		f.Close()
+	}
+}
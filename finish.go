@@ -0,0 +1,149 @@
+package paulstretch
+
+import "math"
+
+// dcBlockPole is the pole of the DC blocker, which sets its cutoff frequency to about 3.5 Hz at 44.1 kHz.
+const dcBlockPole = 0.9995
+
+// finisher applies the finishing touches of WithDCBlock, WithLimiter, WithFade and WithSeamlessLoop
+// to the stretched frames.
+type finisher struct {
+	channels int
+	dcBlock  bool
+	x1, y1   []float64 // previous input and output sample of the DC blocker, per channel
+	limiter  *limiter  // nil if disabled
+	limited  []float32
+	fadeIn   int       // frames
+	fadeOut  int       // frames
+	pos      int64     // frames returned so far
+	tail     []float32 // last frames, held back until the end of the stream is known, for the fade out
+	out      []float32
+	loop     int   // frames of the crossfade of WithSeamlessLoop, 0 if disabled
+	looped   int64 // frames of the loop, once finished, or -1
+}
+
+// newFinisher returns a finisher. ceiling is the ceiling of the limiter, or 0 if it is disabled.
+// loop is the crossfade of WithSeamlessLoop, in frames, or 0 if it is disabled. It replaces the fades.
+func newFinisher(channels int, dcBlock bool, ceiling float64, fadeIn, fadeOut int, loop int) *finisher {
+	f := &finisher{
+		channels: channels,
+		dcBlock:  dcBlock,
+		x1:       make([]float64, channels),
+		y1:       make([]float64, channels),
+		fadeIn:   fadeIn,
+		fadeOut:  fadeOut,
+		loop:     loop,
+		looped:   -1,
+	}
+	if loop > 0 {
+		f.fadeIn, f.fadeOut = 0, 0
+	}
+	if ceiling > 0 {
+		f.limiter = newLimiter(channels, ceiling)
+	}
+	return f
+}
+
+// process removes the DC offset of the frames, limits them and fades them in, and returns the frames ready to be
+// output, valid until the next call. The limiter delays the frames, and if hold is true, the last frames are also
+// held back for the fade out, so that fewer (or no) frames can be returned, until finish is called.
+func (f *finisher) process(frames []float32, hold bool) []float32 {
+	if f.dcBlock {
+		for i, v := range frames {
+			c := i % f.channels
+			// one-pole high-pass filter: y[n] = x[n] - x[n-1] + R*y[n-1]
+			y := float64(v) - f.x1[c] + dcBlockPole*f.y1[c]
+			f.x1[c] = float64(v)
+			f.y1[c] = y
+			frames[i] = float32(y)
+		}
+	}
+	if f.limiter != nil {
+		f.limited = f.limiter.process(frames, f.limited[:0])
+		frames = f.limited
+	}
+	if hold && f.loop > 0 {
+		// the whole stream is held back, to crossfade its end into its start
+		f.tail = append(f.tail, frames...)
+		f.out = f.out[:0]
+	} else if !hold || f.fadeOut == 0 {
+		f.out = append(f.out[:0], frames...)
+	} else {
+		f.tail = append(f.tail, frames...)
+		n := len(f.tail) - f.fadeOut*f.channels
+		if n < 0 {
+			n = 0
+		}
+		f.out = append(f.out[:0], f.tail[:n]...)
+		f.tail = f.tail[:copy(f.tail, f.tail[n:])]
+	}
+	f.fade(f.out)
+	return f.out
+}
+
+// pending returns whether frames are held back by process, until finish is called.
+func (f *finisher) pending() bool {
+	return len(f.tail) > 0 || (f.limiter != nil && len(f.limiter.limits) > 0)
+}
+
+// finish returns the frames held back by process, faded out, at the end of the stream.
+func (f *finisher) finish() []float32 {
+	if f.limiter != nil {
+		f.limited = f.limiter.flush(f.limited[:0])
+		f.tail = append(f.tail, f.limited...)
+	}
+	if f.loop > 0 {
+		f.crossfade()
+		return f.out
+	}
+	f.out = append(f.out[:0], f.tail...)
+	f.tail = f.tail[:0]
+	if f.fadeOut > 0 {
+		frames := len(f.out) / f.channels
+		for i := range f.out {
+			// from 1 to 0 over the last fadeOut frames, which can be fewer if the stream is shorter
+			if j := frames - i/f.channels; j <= f.fadeOut {
+				f.out[i] *= float32(j) / float32(f.fadeOut+1)
+			}
+		}
+	}
+	f.fade(f.out)
+	return f.out
+}
+
+// crossfade sets out to the whole stream held back in tail, with its last frames crossfaded into its first frames
+// and removed, so that it loops seamlessly.
+func (f *finisher) crossfade() {
+	frames := len(f.tail) / f.channels
+	// the crossfade can be at most half the stream, for a shorter stream
+	n := f.loop
+	if n > frames/2 {
+		n = frames / 2
+	}
+	f.looped = int64(frames - n)
+	f.out = append(f.out[:0], f.tail[:(frames-n)*f.channels]...)
+	end := f.tail[(frames-n)*f.channels:]
+	for i := 0; i < n; i++ {
+		// equal-power crossfade, since the stretched audio at both ends is uncorrelated
+		t := float64(i+1) / float64(n+1) * math.Pi / 2
+		in, out := float32(math.Sin(t)), float32(math.Cos(t))
+		for c := 0; c < f.channels; c++ {
+			k := i*f.channels + c
+			f.out[k] = in*f.out[k] + out*end[k]
+		}
+	}
+	f.tail = f.tail[:0]
+	f.pos += int64(len(f.out) / f.channels)
+}
+
+// fade fades in the frames about to be output.
+func (f *finisher) fade(frames []float32) {
+	n := len(frames) / f.channels
+	for i := 0; i < n && f.pos+int64(i) < int64(f.fadeIn); i++ {
+		gain := float32(f.pos+int64(i)+1) / float32(f.fadeIn+1)
+		for c := 0; c < f.channels; c++ {
+			frames[i*f.channels+c] *= gain
+		}
+	}
+	f.pos += int64(n)
+}
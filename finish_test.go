@@ -0,0 +1,247 @@
+package paulstretch
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestFade(t *testing.T) {
+	samples := testSamples(6 * testWindowSize)
+	const fadeIn, fadeOut = 100, 200
+	for _, opts := range [][]Option{nil, {WithOutputBuffers(2)}} {
+		p := NewPaulstretchWithOptions(1, testWindowSize, append(opts, WithFade(fadeIn, fadeOut))...)
+		ref := NewPaulstretchWithOptions(1, testWindowSize, opts...)
+		// compare the outputs of engines without random phases
+		for _, p := range []*Paulstretch{p, ref} {
+			p.ps[0].destroy()
+			p.ps[0] = &identityEngine{}
+		}
+		write := func(p *Paulstretch) func([]float32) error {
+			return func(s []float32) error {
+				_, err := p.WriteSamples(s)
+				return err
+			}
+		}
+		want := stretchAll(t, ref, samples, write(ref), ref.ReadSamples)
+		got := stretchAll(t, p, samples, write(p), p.ReadSamples)
+		if len(got) != len(want) {
+			t.Fatalf("WithFade: got %d stretched samples, want %d", len(got), len(want))
+		}
+		for i := range got {
+			gain := 1.0
+			if i < fadeIn {
+				gain = float64(i+1) / (fadeIn + 1)
+			} else if j := len(got) - 1 - i; j < fadeOut {
+				gain = float64(j+1) / (fadeOut + 1)
+			}
+			if math.Abs(float64(got[i])-gain*float64(want[i])) > 1e-6 {
+				t.Errorf("WithFade: got sample %v at %d, want %v", got[i], i, gain*float64(want[i]))
+				break
+			}
+		}
+	}
+}
+
+func TestDCBlock(t *testing.T) {
+	// a DC offset with a little signal
+	samples := testSamples(64 * testWindowSize)
+	for i := range samples {
+		samples[i] = samples[i]*0.1 + 0.5
+	}
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithDCBlock())
+	out := stretchAll(t, p, samples, func(s []float32) error {
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	// once the filter settled, the mean of the stretched audio is close to 0
+	mean := 0.0
+	tail := out[len(out)/2:]
+	for _, v := range tail {
+		mean += float64(v)
+	}
+	mean /= float64(len(tail))
+	if math.Abs(mean) > 0.05 {
+		t.Errorf("WithDCBlock: got a mean of %v, want about 0", mean)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	// a quiet signal with loud bursts
+	samples := testSamples(16 * testWindowSize)
+	for i := range samples {
+		samples[i] *= 0.1
+		if i/testWindowSize%8 == 4 {
+			samples[i] *= 40
+		}
+	}
+	const ceilingDB = -6
+	ceiling := math.Pow(10, ceilingDB/20.0)
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithLimiter(ceilingDB))
+	ref := NewPaulstretch(1, testWindowSize)
+	// compare the outputs of engines without random phases
+	for _, p := range []*Paulstretch{p, ref} {
+		p.ps[0].destroy()
+		p.ps[0] = &identityEngine{}
+	}
+	write := func(p *Paulstretch) func([]float32) error {
+		return func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}
+	}
+	want := stretchAll(t, ref, samples, write(ref), ref.ReadSamples)
+	got := stretchAll(t, p, samples, write(p), p.ReadSamples)
+	latency := p.Latency() - ref.Latency()
+	if latency != limiterLookahead || len(got) != len(want)+latency {
+		t.Fatalf("WithLimiter: got %d stretched samples and a latency of %d, want %d and %d", len(got), latency, len(want)+latency, limiterLookahead)
+	}
+	for i, v := range got {
+		if math.Abs(float64(v)) > ceiling {
+			t.Fatalf("WithLimiter: got sample %v at %d, want at most %v", v, i, ceiling)
+		}
+		if i < latency && v != 0 {
+			t.Fatalf("WithLimiter: got sample %v at %d, want silence during the look-ahead", v, i)
+		}
+	}
+	// the quiet start of the signal, before the first burst, is not limited
+	for i := latency; i < latency+4*testWindowSize-limiterLookahead; i++ {
+		if got[i] != want[i-latency] {
+			t.Fatalf("WithLimiter: got sample %v at %d, want it unchanged at %v", got[i], i, want[i-latency])
+		}
+	}
+}
+
+func TestLimiterRamp(t *testing.T) {
+	for _, lookahead := range []int{0, 64, maxLimiterLookahead} {
+		l := newLimiter(1, 0.5)
+		l.lookahead = int32(lookahead)
+		// a single peak, twice the ceiling, after the look-ahead
+		frames := make([]float32, 2*maxLimiterLookahead)
+		for i := range frames {
+			frames[i] = 0.25
+		}
+		peak := maxLimiterLookahead + 10
+		frames[peak] = 1
+		out := l.flush(l.process(frames, nil))
+		// the silence of the initial look-ahead comes first
+		out = out[limiterLookahead:]
+		if got := out[peak]; got != 0.5 {
+			t.Errorf("look-ahead %d: got the peak at %v, want it at the ceiling", lookahead, got)
+		}
+		for i := 0; i < peak; i++ {
+			// the gain ramps down linearly over the look-ahead, to the limit of the peak
+			want := 0.25
+			if j := i - (peak - lookahead); j >= 0 {
+				want *= 1 - 0.5*float64(j+1)/float64(lookahead+1)
+			}
+			if math.Abs(float64(out[i])-want) > 1e-6 {
+				t.Fatalf("look-ahead %d: got %v at %d, %d frames before the peak, want %v", lookahead, out[i], i, peak-i, want)
+			}
+		}
+	}
+}
+
+// BenchmarkLimiter shows that the cost of the limiter does not depend on its look-ahead.
+func BenchmarkLimiter(b *testing.B) {
+	for _, lookahead := range []int{limiterLookahead, maxLimiterLookahead} {
+		b.Run(strconv.Itoa(lookahead), func(b *testing.B) {
+			l := newLimiter(2, 0.5)
+			l.lookahead = int32(lookahead)
+			frames := testSamples(2 * 4096)
+			out := make([]float32, 0, len(frames)+2*maxLimiterLookahead)
+			b.SetBytes(int64(len(frames) * 4))
+			for i := 0; i < b.N; i++ {
+				out = l.process(frames, out[:0])
+			}
+		})
+	}
+}
+
+func TestSetLookahead(t *testing.T) {
+	samples := testSamples(16 * testWindowSize)
+	const ceilingDB = -6
+	ceiling := math.Pow(10, ceilingDB/20.0)
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithLimiter(ceilingDB))
+	ref := NewPaulstretch(1, testWindowSize)
+	if err := ref.SetLookahead(64); err != ErrNoLookahead {
+		t.Errorf("SetLookahead without WithLimiter: got error %v, want %v", err, ErrNoLookahead)
+	}
+	for _, lookahead := range []int{-1, maxLimiterLookahead + 1} {
+		if err := p.SetLookahead(lookahead); err != ErrInvalidLookahead {
+			t.Errorf("SetLookahead(%d): got error %v, want %v", lookahead, err, ErrInvalidLookahead)
+		}
+	}
+	write := func(p *Paulstretch, lookaheads ...int) func([]float32) error {
+		return func(s []float32) error {
+			// change the look-ahead between parts of the stream, both ways
+			part := len(s) / (len(lookaheads) + 1)
+			for _, lookahead := range lookaheads {
+				if _, err := p.WriteSamples(s[:part]); err != nil {
+					return err
+				}
+				if err := p.SetLookahead(lookahead); err != nil {
+					return err
+				}
+				s = s[part:]
+			}
+			_, err := p.WriteSamples(s)
+			return err
+		}
+	}
+	want := stretchAll(t, ref, samples, write(ref), ref.ReadSamples)
+	got := stretchAll(t, p, samples, write(p, 1024, 64), p.ReadSamples)
+	if len(got) != len(want)+limiterLookahead {
+		t.Errorf("got %d stretched samples, want %d", len(got), len(want)+limiterLookahead)
+	}
+	for i, v := range got {
+		if math.Abs(float64(v)) > ceiling {
+			t.Fatalf("got sample %v at %d, want at most %v", v, i, ceiling)
+		}
+	}
+	if latency := p.Latency() - ref.Latency(); latency != 64 {
+		t.Errorf("got a latency of %d after SetLookahead(64), want 64", latency)
+	}
+}
+
+func TestSeamlessLoop(t *testing.T) {
+	samples := testSamples(6 * testWindowSize)
+	const crossfade = 300
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithSeamlessLoop(crossfade))
+	ref := NewPaulstretch(1, testWindowSize)
+	for _, p := range []*Paulstretch{p, ref} {
+		p.ps[0].destroy()
+		p.ps[0] = &identityEngine{}
+	}
+	if _, ok := p.LoopLength(); ok {
+		t.Error("LoopLength: got a length before Close")
+	}
+	write := func(p *Paulstretch) func([]float32) error {
+		return func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}
+	}
+	want := stretchAll(t, ref, samples, write(ref), ref.ReadSamples)
+	got := stretchAll(t, p, samples, write(p), p.ReadSamples)
+	if len(got) != len(want)-crossfade {
+		t.Fatalf("WithSeamlessLoop: got %d stretched samples, want %d", len(got), len(want)-crossfade)
+	}
+	if n, ok := p.LoopLength(); !ok || n != int64(len(got)) {
+		t.Errorf("LoopLength: got %d, %v, want %d", n, ok, len(got))
+	}
+	if n := p.EstimateOutputSamples(int64(len(samples))); n != int64(len(got)) {
+		t.Errorf("EstimateOutputSamples: got %d, want %d", n, len(got))
+	}
+	end := want[len(want)-crossfade:]
+	for i := range got {
+		v := float64(want[i])
+		if i < crossfade {
+			a := float64(i+1) / (crossfade + 1) * math.Pi / 2
+			v = math.Sin(a)*v + math.Cos(a)*float64(end[i])
+		}
+		if math.Abs(float64(got[i])-v) > 1e-6 {
+			t.Fatalf("WithSeamlessLoop: got sample %v at %d, want %v", got[i], i, v)
+		}
+	}
+}
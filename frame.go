@@ -0,0 +1,64 @@
+package paulstretch
+
+// FrameReader reads the stretched audio of a Paulstretch in frames of a fixed number of samples, whatever
+// the window size, for example to send stretched audio over the network in payloads of a consistent size.
+type FrameReader struct {
+	p     *Paulstretch
+	frame []float32
+	n     int   // samples of frame already read
+	err   error // error to return once the last frame was returned
+}
+
+// NewFrameReader returns a FrameReader of the stretched audio of p in frames of frameSize samples (counting
+// the samples of all channels, so that frameSize should be a multiple of the number of channels).
+// Values lower than 1 are replaced with OptimalBufferSize.
+//
+// The stretched audio must then only be read from the FrameReader, rather than from p directly.
+func NewFrameReader(p *Paulstretch, frameSize int) *FrameReader {
+	if frameSize < 1 {
+		frameSize = p.OptimalBufferSize()
+	}
+	return &FrameReader{
+		p:     p,
+		frame: make([]float32, frameSize),
+	}
+}
+
+// ReadFrame reads the next frame of stretched audio, blocking until it is filled with exactly frameSize samples,
+// and returns it, valid until the next call.
+//
+// At the end of the stretched audio, the last frame can be shorter, and last is true. A last frame of exactly
+// frameSize samples is only flagged if the end of the stretched audio is already known once it is filled, that is
+// if Paulstretch was closed and all its stretched audio read; otherwise the next call returns no frame and io.EOF.
+// Once the last frame was returned, ReadFrame returns io.EOF, or the error set by CloseWithError.
+//
+// On ErrDeadlineExceeded or ErrOutputLimitExceeded, ReadFrame returns no frame: the samples read so far
+// are kept, and the next call continues filling the frame.
+func (r *FrameReader) ReadFrame() (frame []float32, last bool, err error) {
+	if r.err != nil {
+		return nil, false, r.err
+	}
+	for r.n < len(r.frame) && err == nil {
+		var m int
+		m, err = r.p.ReadSamples(r.frame[r.n:])
+		r.n += m
+	}
+	if err == ErrOutputLimitExceeded || err == ErrDeadlineExceeded {
+		// more stretched audio can be read later
+		return nil, false, err
+	}
+	n := r.n
+	r.n = 0
+	if err == nil {
+		// check whether the end is already known, without blocking
+		if _, err = r.p.Read(nil); err == nil {
+			return r.frame, false, nil
+		}
+	}
+	// the end of the stretched audio, with io.EOF or the error of CloseWithError
+	r.err = err
+	if n == 0 {
+		return nil, false, err
+	}
+	return r.frame[:n], true, nil
+}
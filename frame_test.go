@@ -0,0 +1,42 @@
+package paulstretch
+
+import (
+	"io"
+	"testing"
+)
+
+func TestFrameReader(t *testing.T) {
+	const frameSize = 100
+	p := NewPaulstretch(2, testWindowSize)
+	go func() {
+		p.WriteSamples(testSamples(3*testWindowSize + 5))
+		p.CloseFlush()
+	}()
+	r := NewFrameReader(p, frameSize)
+	total := 0
+	for {
+		frame, last, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		total += len(frame)
+		if last {
+			if len(frame) == 0 || len(frame) > frameSize {
+				t.Errorf("ReadFrame: got a last frame of %d samples, want 1 to %d", len(frame), frameSize)
+			}
+			if _, _, err := r.ReadFrame(); err != io.EOF {
+				t.Errorf("ReadFrame after the last frame: got error %v, want EOF", err)
+			}
+			break
+		}
+		if len(frame) != frameSize {
+			t.Fatalf("ReadFrame: got a frame of %d samples, want %d", len(frame), frameSize)
+		}
+	}
+	if want := p.EstimateOutputSamples(3*testWindowSize + 5); int64(total) != want {
+		t.Errorf("ReadFrame: got %d stretched samples, want %d", total, want)
+	}
+}
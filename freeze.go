@@ -0,0 +1,29 @@
+package paulstretch
+
+// Freeze freezes the stretched audio on the last window of samples written, and sustains it indefinitely until
+// Unfreeze is called: Read keeps returning stretched audio of this window, with fresh random phases for each
+// output window, as in an infinite stretch.
+//
+// The input is ignored while frozen: Write and Flush block until Unfreeze or Close is called (the write deadline
+// does not apply), so that the input is kept by the writer rather than dropped, and stretched once unfrozen.
+// If no window was written yet, silence is sustained. Freeze does not affect ProcessWindow.
+func (p *Paulstretch) Freeze() {
+	if !p.initialized() {
+		return
+	}
+	p.rwCond.L.Lock()
+	p.frozen = true
+	p.rwCond.Broadcast()
+	p.rwCond.L.Unlock()
+}
+
+// Unfreeze stops sustaining the window frozen by Freeze, and resumes the stretching of the input written.
+func (p *Paulstretch) Unfreeze() {
+	if !p.initialized() {
+		return
+	}
+	p.rwCond.L.Lock()
+	p.frozen = false
+	p.rwCond.Broadcast()
+	p.rwCond.L.Unlock()
+}
@@ -0,0 +1,66 @@
+package paulstretch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreeze(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	defer p.Close()
+	// use an engine without random phases, so that the sustained window can be checked
+	p.ps[0].destroy()
+	p.ps[0] = &identityEngine{}
+	frozen := testSamples(testWindowSize)
+	if _, err := p.WriteSamples(frozen); err != nil {
+		t.Fatal(err)
+	}
+	p.Freeze()
+	written := make(chan error, 1)
+	go func() {
+		_, err := p.WriteSamples(make([]float32, testWindowSize))
+		written <- err
+	}()
+	// the frozen window is sustained, however much is read
+	buf := make([]float32, testWindowSize)
+	for i := 0; i < 10; i++ {
+		if _, err := readFull(p, buf); err != nil {
+			t.Fatal(err)
+		}
+		for j, v := range buf {
+			if v != frozen[j] {
+				t.Fatalf("read %d while frozen: got sample %v at %d, want %v", i, v, j, frozen[j])
+			}
+		}
+	}
+	select {
+	case err := <-written:
+		t.Fatalf("WriteSamples while frozen: returned %v, want it to block", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	p.Unfreeze()
+	// the window written during the freeze is stretched once unfrozen
+	for {
+		if _, err := readFull(p, buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf[1] == 0 {
+			break
+		}
+	}
+	if err := <-written; err != nil {
+		t.Errorf("WriteSamples after Unfreeze: %v", err)
+	}
+}
+
+func readFull(p *Paulstretch, samples []float32) (int, error) {
+	n := 0
+	for n < len(samples) {
+		m, err := p.ReadSamples(samples[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -1,3 +1,3 @@
 module github.com/delthas/go-paulstretch
 
-go 1.13
+go 1.17
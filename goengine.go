@@ -0,0 +1,110 @@
+package paulstretch
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+)
+
+// goEngine is an engine using a pure Go implementation of the Paulstretch algorithm, used when cgo is disabled.
+//
+// Each frame of input, of a window of samples, is windowed, its spectrum is computed, the phases of the
+// spectrum are randomized, and the resulting frame is windowed again and overlap-added to the output, every
+// half window. The frames of input are spaced by half a window divided by the stretch factor.
+type goEngine struct {
+	windowSize int
+	hop        int       // output samples per frame
+	displace   float64   // input samples between two consecutive frames
+	window     []float64 // analysis and synthesis window
+	fft        *fft
+	spectrum   []complex128
+	in         []float32 // input samples not yet fully used, after a window of silence
+	pos        float64   // position in in of the next frame
+	acc        []float64 // overlap-added output frames, starting at the next output sample
+	queue      []float32 // output samples not yet read
+	out        []float32 // window returned by read
+}
+
+func newGoEngine(stretchFactor float64, windowSize int) *goEngine {
+	hop := windowSize / 2
+	if hop == 0 {
+		hop = 1
+	}
+	e := &goEngine{
+		windowSize: windowSize,
+		hop:        hop,
+		displace:   float64(hop) / stretchFactor,
+		window:     make([]float64, windowSize),
+		fft:        newFFT(windowSize),
+		spectrum:   make([]complex128, windowSize),
+		// start with a window of silence, so that each window of input produces its stretched audio right away
+		in:  make([]float32, windowSize),
+		acc: make([]float64, windowSize),
+		out: make([]float32, windowSize),
+	}
+	// the square of a sine window sums to 1 with an overlap of half a window
+	for i := range e.window {
+		e.window[i] = math.Sin(math.Pi * (float64(i) + 0.5) / float64(windowSize))
+	}
+	return e
+}
+
+func (e *goEngine) write(samples []float32) {
+	e.in = append(e.in, samples[:e.windowSize]...)
+}
+
+func (e *goEngine) read() ([]float32, bool) {
+	for len(e.queue) < e.windowSize {
+		if int(e.pos)+e.windowSize > len(e.in) {
+			return nil, false
+		}
+		e.frame()
+	}
+	n := copy(e.out, e.queue)
+	e.queue = e.queue[:copy(e.queue, e.queue[n:])]
+	return e.out, true
+}
+
+// frame stretches the frame of input at pos, and appends a hop of output samples to queue.
+func (e *goEngine) frame() {
+	n := e.windowSize
+	start := int(e.pos)
+	for i := range e.spectrum {
+		e.spectrum[i] = complex(float64(e.in[start+i])*e.window[i], 0)
+	}
+	e.fft.transform(e.spectrum)
+	// randomize the phases, keeping the spectrum symmetric so that the frame stays real
+	e.spectrum[0] = complex(cmplx.Abs(e.spectrum[0]), 0)
+	for k := 1; k < n-k; k++ {
+		e.spectrum[k] = cmplx.Rect(cmplx.Abs(e.spectrum[k]), 2*math.Pi*rand.Float64())
+		e.spectrum[n-k] = cmplx.Conj(e.spectrum[k])
+	}
+	if n%2 == 0 {
+		e.spectrum[n/2] = complex(cmplx.Abs(e.spectrum[n/2]), 0)
+	}
+	e.fft.inverse(e.spectrum)
+	for i, v := range e.spectrum {
+		e.acc[i] += real(v) * e.window[i]
+	}
+	for _, v := range e.acc[:e.hop] {
+		e.queue = append(e.queue, float32(v))
+	}
+	copy(e.acc, e.acc[e.hop:])
+	for i := n - e.hop; i < n; i++ {
+		e.acc[i] = 0
+	}
+	e.pos += e.displace
+	if drop := int(e.pos); drop > 0 {
+		e.in = e.in[:copy(e.in, e.in[drop:])]
+		e.pos -= float64(drop)
+	}
+}
+
+func (e *goEngine) latency() int {
+	// the input starts with a window of silence, stretched, and the synthesized frames are centered
+	// half a window after their position
+	stretchFactor := float64(e.hop) / e.displace
+	return int(math.Round(float64(e.windowSize)*stretchFactor/2)) + e.windowSize/2
+}
+
+func (e *goEngine) destroy() {}
@@ -0,0 +1,59 @@
+package paulstretch
+
+import "math"
+
+// int24Scale is the scale of 24-bit signed PCM samples, which are in [-int24Scale, int24Scale-1].
+const int24Scale = 1 << 23
+
+// WriteInt24Samples is like WriteSamples, for packed 24-bit signed PCM samples: 3 bytes per sample, little-endian,
+// as delivered by many audio interfaces. The samples are scaled by 1/8388608 to [-1, 1).
+//
+// WriteInt24Samples returns the number of samples written, and ErrInvalidInt24 if the length of packed is not
+// a multiple of 3, in which case nothing is written.
+func (p *Paulstretch) WriteInt24Samples(packed []byte) (int, error) {
+	if len(packed)%3 != 0 {
+		return 0, ErrInvalidInt24
+	}
+	n := len(packed) / 3
+	if cap(p.writeConv) < n {
+		p.writeConv = make([]float32, n)
+	}
+	p.writeConv = p.writeConv[:n]
+	for i := range p.writeConv {
+		b := packed[i*3:]
+		// sign-extend the 24-bit value
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		p.writeConv[i] = float32(v) / int24Scale
+	}
+	return p.WriteSamples(p.writeConv)
+}
+
+// ReadInt24Samples is like ReadSamples, for packed 24-bit signed PCM samples: 3 bytes per sample, little-endian.
+// The stretched samples are scaled by 8388608, dithered with WithDither, rounded, and clamped to the 24-bit range.
+//
+// ReadInt24Samples returns the number of samples read into out, and ErrInvalidInt24 if the length of out is not
+// a multiple of 3, in which case nothing is read.
+func (p *Paulstretch) ReadInt24Samples(out []byte) (int, error) {
+	if len(out)%3 != 0 {
+		return 0, ErrInvalidInt24
+	}
+	n := len(out) / 3
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	if cap(p.readConv) < n {
+		p.readConv = make([]float32, n)
+	}
+	p.readConv = p.readConv[:n]
+	n, err := p.readSamples(p.readConv)
+	for i, v := range p.readConv[:n] {
+		f := float64(v) * int24Scale
+		if p.dither != nil {
+			f += p.dither.next()
+		}
+		s := int32(math.Max(-int24Scale, math.Min(int24Scale-1, math.Round(f))))
+		out[i*3] = byte(s)
+		out[i*3+1] = byte(s >> 8)
+		out[i*3+2] = byte(s >> 16)
+	}
+	return n, err
+}
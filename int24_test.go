@@ -0,0 +1,77 @@
+package paulstretch
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInt24Samples(t *testing.T) {
+	// the extremes of the 24-bit range, and values around 0
+	packed := []byte{
+		0x00, 0x00, 0x80, // -8388608
+		0x01, 0x00, 0x80, // -8388607
+		0xff, 0xff, 0xff, // -1
+		0x00, 0x00, 0x00, // 0
+		0x01, 0x00, 0x00, // 1
+		0xfe, 0xff, 0x7f, // 8388606
+		0xff, 0xff, 0x7f, // 8388607
+	}
+	for _, tc := range []struct {
+		packed []byte
+		want   float32
+	}{
+		{packed[0:3], -1},
+		{packed[9:12], 0},
+		{packed[12:15], 1.0 / 8388608},
+		{packed[18:21], 8388607.0 / 8388608},
+	} {
+		// a stretch factor of 1 passes the audio through
+		p := NewPaulstretch(1, testWindowSize)
+		if _, err := p.WriteInt24Samples(tc.packed); err != nil {
+			t.Fatal(err)
+		}
+		p.CloseFlush()
+		out := make([]float32, 1)
+		if _, err := p.ReadSamples(out); err != nil || out[0] != tc.want {
+			t.Errorf("WriteInt24Samples(%x): got sample (%v, %v), want %v", tc.packed, out[0], err, tc.want)
+		}
+	}
+
+	// round trip
+	p := NewPaulstretch(1, testWindowSize)
+	data := bytes.Repeat(packed, testWindowSize)
+	go func() {
+		p.WriteInt24Samples(data)
+		p.CloseFlush()
+	}()
+	out := make([]byte, len(data))
+	n := 0
+	for n < len(out)/3 {
+		m, err := p.ReadInt24Samples(out[n*3:])
+		n += m
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("ReadInt24Samples: got %x, want %x", out[:21], data[:21])
+	}
+
+	// clamping of the stretched samples out of range
+	p = NewPaulstretch(1, testWindowSize)
+	if _, err := p.WriteSamples([]float32{-2, 2}); err != nil {
+		t.Fatal(err)
+	}
+	p.CloseFlush()
+	out = make([]byte, 6)
+	if _, err := p.ReadInt24Samples(out); err != nil || !bytes.Equal(out, []byte{0x00, 0x00, 0x80, 0xff, 0xff, 0x7f}) {
+		t.Errorf("ReadInt24Samples out of range: got (%x, %v), want (%x, nil)", out, err, []byte{0x00, 0x00, 0x80, 0xff, 0xff, 0x7f})
+	}
+
+	if _, err := p.WriteInt24Samples(make([]byte, 4)); err != ErrInvalidInt24 {
+		t.Errorf("WriteInt24Samples with 4 bytes: got error %v, want %v", err, ErrInvalidInt24)
+	}
+	if _, err := p.ReadInt24Samples(make([]byte, 5)); err != ErrInvalidInt24 {
+		t.Errorf("ReadInt24Samples with 5 bytes: got error %v, want %v", err, ErrInvalidInt24)
+	}
+}
@@ -0,0 +1,52 @@
+package paulstretch
+
+// Interleave interleaves planar samples, one slice per channel, into frames of samples in out,
+// for use with WriteSamples and WithChannels, and returns the number of frames written to out.
+//
+// Interleave does not allocate. If the slices have mismatched lengths, only the frames for which every channel
+// has a sample and which fit in out are interleaved.
+func Interleave(planar [][]float32, out []float32) int {
+	channels := len(planar)
+	if channels == 0 {
+		return 0
+	}
+	frames := len(out) / channels
+	for _, samples := range planar {
+		if len(samples) < frames {
+			frames = len(samples)
+		}
+	}
+	for c, samples := range planar {
+		for i, v := range samples[:frames] {
+			out[i*channels+c] = v
+		}
+	}
+	return frames
+}
+
+// Deinterleave deinterleaves frames of samples of channels channels, as read with ReadSamples and WithChannels,
+// into planar samples in out, one slice per channel, and returns the number of frames written to out.
+//
+// Deinterleave does not allocate. If the slices have mismatched lengths, only the complete frames of interleaved
+// that fit in every slice of out are deinterleaved. If out has fewer slices than channels, the other channels
+// are skipped.
+func Deinterleave(interleaved []float32, channels int, out [][]float32) int {
+	if channels <= 0 {
+		return 0
+	}
+	frames := len(interleaved) / channels
+	if len(out) > channels {
+		out = out[:channels]
+	}
+	for _, samples := range out {
+		if len(samples) < frames {
+			frames = len(samples)
+		}
+	}
+	for c, samples := range out {
+		for i := range samples[:frames] {
+			samples[i] = interleaved[i*channels+c]
+		}
+	}
+	return frames
+}
@@ -0,0 +1,62 @@
+package paulstretch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterleave(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		planar      [][]float32
+		out         int
+		frames      int
+		interleaved []float32
+	}{
+		{"stereo", [][]float32{{1, 2, 3}, {4, 5, 6}}, 6, 3, []float32{1, 4, 2, 5, 3, 6}},
+		{"mismatched channels", [][]float32{{1, 2, 3}, {4, 5}}, 6, 2, []float32{1, 4, 2, 5, 0, 0}},
+		{"short output", [][]float32{{1, 2, 3}, {4, 5, 6}}, 5, 2, []float32{1, 4, 2, 5, 0}},
+		{"no channels", nil, 4, 0, []float32{0, 0, 0, 0}},
+	} {
+		out := make([]float32, tc.out)
+		if frames := Interleave(tc.planar, out); frames != tc.frames || !reflect.DeepEqual(out, tc.interleaved) {
+			t.Errorf("%s: Interleave: got (%d, %v), want (%d, %v)", tc.name, frames, out, tc.frames, tc.interleaved)
+		}
+	}
+}
+
+func TestDeinterleave(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		interleaved []float32
+		channels    int
+		out         []int
+		frames      int
+		planar      [][]float32
+	}{
+		{"stereo", []float32{1, 4, 2, 5, 3, 6}, 2, []int{3, 3}, 3, [][]float32{{1, 2, 3}, {4, 5, 6}}},
+		{"partial frame", []float32{1, 4, 2, 5, 3}, 2, []int{3, 3}, 2, [][]float32{{1, 2, 0}, {4, 5, 0}}},
+		{"mismatched channels", []float32{1, 4, 2, 5, 3, 6}, 2, []int{3, 1}, 1, [][]float32{{1, 0, 0}, {4}}},
+		{"fewer channels", []float32{1, 4, 2, 5}, 2, []int{2}, 2, [][]float32{{1, 2}}},
+		{"invalid channels", []float32{1, 2}, 0, []int{2}, 0, [][]float32{{0, 0}}},
+	} {
+		out := make([][]float32, len(tc.out))
+		for i, n := range tc.out {
+			out[i] = make([]float32, n)
+		}
+		if frames := Deinterleave(tc.interleaved, tc.channels, out); frames != tc.frames || !reflect.DeepEqual(out, tc.planar) {
+			t.Errorf("%s: Deinterleave: got (%d, %v), want (%d, %v)", tc.name, frames, out, tc.frames, tc.planar)
+		}
+	}
+}
+
+func TestInterleaveAllocs(t *testing.T) {
+	planar := [][]float32{make([]float32, 1024), make([]float32, 1024)}
+	interleaved := make([]float32, 2048)
+	if allocs := testing.AllocsPerRun(10, func() {
+		Interleave(planar, interleaved)
+		Deinterleave(interleaved, 2, planar)
+	}); allocs != 0 {
+		t.Errorf("Interleave and Deinterleave: got %v allocations, want 0", allocs)
+	}
+}
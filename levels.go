@@ -0,0 +1,51 @@
+package paulstretch
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// levelWindow is the length of the sliding window of the RMS level of OutputLevels, in samples:
+// about 46 ms of mono audio at 44.1 kHz.
+const levelWindow = 2048
+
+// levels holds the levels of the stretched audio read, for OutputLevels.
+type levels struct {
+	peak  uint64  // bits of the peak level of the last read, read atomically
+	rms   uint64  // bits of the RMS level, read atomically
+	power float64 // mean square over the sliding window, updated by Read with readMu held
+}
+
+// OutputLevels returns the peak and RMS levels of the stretched audio read from Paulstretch, for example
+// for a VU meter, relative to full scale (1 for a sample of 1). OutputLevels can be called concurrently
+// with Read, and is updated as Read (or TryRead) returns stretched audio.
+//
+// The peak level is that of the stretched audio returned by the last Read call, and the RMS level is measured
+// over a sliding window of about the last 2048 samples (counting the samples of all channels), with
+// an exponential moving average. Both levels are 0 until stretched audio is read.
+func (p *Paulstretch) OutputLevels() (peak, rms float64) {
+	if !p.initialized() {
+		return 0, 0
+	}
+	peak = math.Float64frombits(atomic.LoadUint64(&p.levels.peak))
+	rms = math.Float64frombits(atomic.LoadUint64(&p.levels.rms))
+	return peak, rms
+}
+
+// meter updates the levels with data, just read.
+func (p *Paulstretch) meter(data []byte) {
+	peak := 0.0
+	power := p.levels.power
+	for i := 0; i+4 <= len(data); i += 4 {
+		v := float64(math.Float32frombits(p.byteOrder.Uint32(data[i:])))
+		if p.outRange != nil {
+			// measure the stretched audio, rather than its mapping to the output range
+			v = (v-p.outRange.min)/(p.outRange.max-p.outRange.min)*2 - 1
+		}
+		peak = math.Max(peak, math.Abs(v))
+		power += (v*v - power) / levelWindow
+	}
+	p.levels.power = power
+	atomic.StoreUint64(&p.levels.peak, math.Float64bits(peak))
+	atomic.StoreUint64(&p.levels.rms, math.Float64bits(math.Sqrt(power)))
+}
@@ -0,0 +1,42 @@
+package paulstretch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOutputLevels(t *testing.T) {
+	// a square wave of amplitude 0.5 passed through, whose peak and RMS levels are 0.5
+	samples := make([]float32, 8*testWindowSize)
+	for i := range samples {
+		samples[i] = 0.5
+		if i%2 == 1 {
+			samples[i] = -0.5
+		}
+	}
+	p := NewPaulstretch(1, testWindowSize)
+	if peak, rms := p.OutputLevels(); peak != 0 || rms != 0 {
+		t.Errorf("OutputLevels before Read: got (%v, %v), want (0, 0)", peak, rms)
+	}
+	go func() {
+		p.WriteSamples(samples)
+		p.CloseFlush()
+	}()
+	buf := make([]float32, len(samples))
+	n := 0
+	for n < len(buf) {
+		m, err := p.ReadSamples(buf[n:])
+		if err != nil {
+			t.Fatalf("ReadSamples: %v", err)
+		}
+		n += m
+	}
+	peak, rms := p.OutputLevels()
+	if math.Abs(peak-0.5) > 1e-6 {
+		t.Errorf("OutputLevels: got a peak level of %v, want 0.5", peak)
+	}
+	// the moving average starts from silence
+	if want := 0.5 * math.Sqrt(1-math.Pow(1-1.0/levelWindow, float64(len(samples)))); math.Abs(rms-want) > 1e-3 {
+		t.Errorf("OutputLevels: got a RMS level of %v, want %v", rms, want)
+	}
+}
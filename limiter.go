@@ -0,0 +1,145 @@
+package paulstretch
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// limiterLookahead is the initial look-ahead of the limiter of WithLimiter, in frames: about 5.8 ms at 44.1 kHz.
+const limiterLookahead = 256
+
+// maxLimiterLookahead is the maximum look-ahead of the limiter, set with SetLookahead, in frames: about 186 ms
+// at 44.1 kHz.
+const maxLimiterLookahead = 8192
+
+// limiterRelease is the proportion of the attenuation of the limiter recovered per frame, which sets its release
+// time constant to about 45 ms at 44.1 kHz.
+const limiterRelease = 0.0005
+
+// limiter is a look-ahead brick-wall limiter: it delays the frames by its look-ahead, starting with limiterLookahead
+// frames of silence, and lowers their gain ahead of each peak above the ceiling, linearly over the look-ahead,
+// so that no sample exceeds the ceiling.
+//
+// The gain of each frame is the average, over the look-ahead, of the minimum limit of the frames within
+// the look-ahead of the last frames: a sliding minimum, kept in a monotonic deque, followed by a moving average,
+// which ramps the gain down linearly to the limit of each peak, reached when the peak is output, in constant
+// time per frame whatever the look-ahead.
+type limiter struct {
+	lookahead int32 // frames, accessed atomically, so that SetLookahead does not wait for Read
+	channels  int
+	ceiling   float64
+	gain      float64   // gain of the last frame output
+	frames    []float32 // delayed frames, not yet output
+	limits    []float64 // maximum gain of each delayed frame, for its peak not to exceed the ceiling
+	base      int64     // index in the stream of the first delayed frame, that of limits[0]
+	next      int64     // index in the stream of the next frame whose limit enters mins
+	mins      []int64   // indices in the stream of the frames of increasing limits, from the frame output on
+	box       []float64 // minimum limits of the last lookahead+1 frames output, a ring
+	boxPos    int
+	boxSum    float64
+}
+
+func newLimiter(channels int, ceiling float64) *limiter {
+	l := &limiter{
+		lookahead: limiterLookahead,
+		channels:  channels,
+		ceiling:   ceiling,
+		gain:      1,
+		frames:    make([]float32, limiterLookahead*channels),
+		limits:    make([]float64, limiterLookahead),
+	}
+	for i := range l.limits {
+		l.limits[i] = 1
+	}
+	l.resize(limiterLookahead)
+	return l
+}
+
+// resize sets the number of frames of the moving average of the gain to lookahead+1, when the look-ahead changes.
+// The average restarts from the current gain, and the sliding minimum from the next frame output.
+func (l *limiter) resize(lookahead int) {
+	l.box = make([]float64, lookahead+1)
+	for i := range l.box {
+		l.box[i] = l.gain
+	}
+	l.boxPos = 0
+	l.boxSum = l.gain * float64(len(l.box))
+	l.mins = l.mins[:0]
+	l.next = l.base
+}
+
+// process delays frames, and appends the limited frames that are no longer delayed to out.
+func (l *limiter) process(frames []float32, out []float32) []float32 {
+	l.frames = append(l.frames, frames...)
+	for i := 0; i < len(frames); i += l.channels {
+		peak := 0.0
+		for _, v := range frames[i : i+l.channels] {
+			peak = math.Max(peak, math.Abs(float64(v)))
+		}
+		limit := 1.0
+		if peak > l.ceiling {
+			limit = l.ceiling / peak
+		}
+		l.limits = append(l.limits, limit)
+	}
+	// a shorter look-ahead outputs the frames no longer delayed at once, and a longer one only delays the next
+	// frames, so that no frame is dropped or added when it changes
+	return l.output(len(l.limits)-l.getLookahead(), out)
+}
+
+// flush appends all the delayed frames to out, limited, at the end of the stream.
+func (l *limiter) flush(out []float32) []float32 {
+	return l.output(len(l.limits), out)
+}
+
+// output appends the first n delayed frames to out, limited, and removes them from the delayed frames.
+func (l *limiter) output(n int, out []float32) []float32 {
+	if n <= 0 {
+		return out
+	}
+	lookahead := l.getLookahead()
+	if len(l.box) != lookahead+1 {
+		l.resize(lookahead)
+	}
+	end := l.base + int64(len(l.limits))
+	for i := 0; i < n; i++ {
+		pos := l.base + int64(i)
+		// the frames before the frame output leave the deque, and the limits of the frames within the look-ahead enter the deque, which keeps them increasing
+		for len(l.mins) > 0 && l.mins[0] < pos {
+			l.mins = l.mins[1:]
+		}
+		for ; l.next < end && l.next <= pos+int64(lookahead); l.next++ {
+			limit := l.limits[l.next-l.base]
+			for len(l.mins) > 0 && l.limits[l.mins[len(l.mins)-1]-l.base] >= limit {
+				l.mins = l.mins[:len(l.mins)-1]
+			}
+			l.mins = append(l.mins, l.next)
+		}
+		min := l.limits[l.mins[0]-l.base]
+		l.boxSum += min - l.box[l.boxPos]
+		l.box[l.boxPos] = min
+		if l.boxPos++; l.boxPos == len(l.box) {
+			l.boxPos = 0
+			// sum again once per round, so that the rounding errors of the running sum do not accumulate
+			l.boxSum = 0
+			for _, v := range l.box {
+				l.boxSum += v
+			}
+		}
+		gain := math.Min(l.gain+(1-l.gain)*limiterRelease, l.boxSum/float64(len(l.box)))
+		l.gain = gain
+		for _, v := range l.frames[i*l.channels : (i+1)*l.channels] {
+			// clamp the rounding errors of the gain
+			out = append(out, float32(math.Max(-l.ceiling, math.Min(l.ceiling, float64(v)*gain))))
+		}
+	}
+	l.frames = l.frames[:copy(l.frames, l.frames[n*l.channels:])]
+	l.limits = l.limits[:copy(l.limits, l.limits[n:])]
+	l.base += int64(n)
+	return out
+}
+
+// getLookahead returns the look-ahead of the limiter, in frames.
+func (l *limiter) getLookahead() int {
+	return int(atomic.LoadInt32(&l.lookahead))
+}
@@ -0,0 +1,29 @@
+package paulstretch
+
+import "sync/atomic"
+
+// SetLookahead sets the look-ahead of the limiter of WithLimiter, in frames (samples per channel), from 0
+// to 8192 (about 186 ms at 44.1 kHz), initially 256, while Paulstretch is in use, for example for a live operator
+// to trade the quality of the limiting of short peaks against latency. Latency then reports the new latency.
+//
+// The look-ahead delays the stretched audio: lowering it returns the frames no longer delayed at the next Read,
+// and raising it delays the stretched audio that follows, so that no frame is dropped or added, and the length
+// of the stretched audio, as returned by EstimateOutputSamples, does not change. The stretched audio already
+// read, or made available to Read, keeps the look-ahead it was limited with. The cost of the limiter does not depend
+// on its look-ahead, but right after a change, the peaks within the look-ahead can be clipped to the ceiling rather
+// than limited smoothly.
+//
+// SetLookahead returns ErrNoLookahead without WithLimiter, and ErrInvalidLookahead if samples is out of range.
+func (p *Paulstretch) SetLookahead(samples int) error {
+	if !p.initialized() {
+		return ErrClosed
+	}
+	if p.finisher == nil || p.finisher.limiter == nil {
+		return ErrNoLookahead
+	}
+	if samples < 0 || samples > maxLimiterLookahead {
+		return ErrInvalidLookahead
+	}
+	atomic.StoreInt32(&p.finisher.limiter.lookahead, int32(samples))
+	return nil
+}
@@ -0,0 +1,102 @@
+package paulstretch
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// MarkerEvent is a marker added with AddMarker whose stretched audio was read, as returned by Markers.
+type MarkerEvent struct {
+	// OutputSample is the position of the marker in the stretched audio, in frames since the start of the stream.
+	OutputSample int64
+	// InputSample is the position of the marker in the input, in frames, as passed to AddMarker.
+	InputSample int64
+}
+
+// markers holds the markers of AddMarker.
+type markers struct {
+	mu      sync.Mutex
+	count   int32   // len(pending), accessed atomically so that reads without markers do not lock mu
+	pending []int64 // input positions of the markers not yet passed, in order
+	passed  []MarkerEvent
+}
+
+// AddMarker adds a marker at a position in the input, in frames (samples per channel) since the start
+// of the stream, for example at the beats of the input, to keep the markers of the timeline of an editor in sync
+// with the stretched audio. The marker is returned by Markers once the stretched audio at its output position
+// is read.
+//
+// The output position of a marker is its position in the input mapped through the stretch factor, which can
+// vary with WithStretchEnvelope or QueueStretchChange, plus the latency (see Latency): it is the center
+// of the stretched audio of the marker, and is accurate to within a window, since a sample of input is smeared
+// over a window of stretched audio. With a varying stretch factor, the output position of a marker is only known
+// once the window of input at the marker is written. Markers past the end of the stretched audio are never passed.
+func (p *Paulstretch) AddMarker(inputSample int64) {
+	if !p.initialized() {
+		return
+	}
+	m := &p.markers
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.Search(len(m.pending), func(i int) bool { return m.pending[i] > inputSample })
+	m.pending = append(m.pending, 0)
+	copy(m.pending[i+1:], m.pending[i:])
+	m.pending[i] = inputSample
+	atomic.StoreInt32(&m.count, int32(len(m.pending)))
+}
+
+// Markers returns the markers added with AddMarker whose stretched audio was read since the last call, in order.
+// Markers can be called concurrently with Read, for example by the goroutine updating the timeline.
+func (p *Paulstretch) Markers() []MarkerEvent {
+	if !p.initialized() {
+		return nil
+	}
+	m := &p.markers
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	passed := m.passed
+	m.passed = nil
+	return passed
+}
+
+// passMarkers moves the markers whose output position was read to the passed markers.
+func (p *Paulstretch) passMarkers() {
+	m := &p.markers
+	if atomic.LoadInt32(&m.count) == 0 {
+		return
+	}
+	read := atomic.LoadInt64(&p.stats.bytesRead) / int64(4*p.channels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.pending) > 0 {
+		out, ok := p.outputPosition(m.pending[0])
+		if !ok || out >= read {
+			break
+		}
+		m.passed = append(m.passed, MarkerEvent{OutputSample: out, InputSample: m.pending[0]})
+		m.pending = m.pending[1:]
+	}
+	atomic.StoreInt32(&m.count, int32(len(m.pending)))
+}
+
+// outputPosition returns the output position of an input position, both in frames, the inverse of
+// InputPositionForOutput, and whether it is known yet.
+func (p *Paulstretch) outputPosition(inputSample int64) (int64, bool) {
+	in := float64(inputSample)
+	if p.inResampler != nil {
+		in /= p.inResampler.step
+	}
+	var out float64
+	if p.envelope != nil {
+		windows, ok := p.envelope.outputPosition(in, p.windowSize)
+		if !ok {
+			return 0, false
+		}
+		out = windows * float64(p.windowSize)
+	} else {
+		out = in * p.stretchFactor
+	}
+	return int64(math.Round(out)) + int64(p.Latency()), true
+}
@@ -0,0 +1,35 @@
+package paulstretch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarkers(t *testing.T) {
+	p := NewPaulstretch(4, testWindowSize)
+	latency := int64(p.Latency())
+	samples := testSamples(3 * testWindowSize)
+	p.AddMarker(100)
+	p.AddMarker(100 * testWindowSize) // past the end
+	p.AddMarker(0)
+	if got := p.Markers(); len(got) != 0 {
+		t.Errorf("markers passed before reading: %v", got)
+	}
+	out := stretchAll(t, p, samples, func(s []float32) error {
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	if int64(len(out)) <= latency+400 {
+		t.Fatalf("got %d stretched samples, want more than %d", len(out), latency+400)
+	}
+	want := []MarkerEvent{
+		{OutputSample: latency, InputSample: 0},
+		{OutputSample: latency + 400, InputSample: 100},
+	}
+	if got := p.Markers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got markers %v, want %v", got, want)
+	}
+	if got := p.Markers(); len(got) != 0 {
+		t.Errorf("markers passed twice: %v", got)
+	}
+}
@@ -0,0 +1,70 @@
+package paulstretch
+
+// MaxMemoryForWindow returns the approximate memory, in bytes, held by a Paulstretch of a window size and number
+// of channels created with NewPaulstretch or NewPaulstretchWithOptions without buffering options, as returned
+// by its MemoryUsage, so that over-large windows can be rejected before creating it, for example to enforce quotas.
+//
+// It is an upper bound of the memory of such an instance: with a stretch factor of 1, or for mono audio
+// without processing options, the instance holds less. See MemoryUsage for the buffers counted.
+func MaxMemoryForWindow(windowSize, channels int) int64 {
+	if windowSize < minWindowSize {
+		windowSize = minWindowSize
+	}
+	window := int64(windowSize) * int64(channels) * 4
+	// the engines, the write and read buffers, the last window, and the deinterleaved input and output
+	return int64(channels)*engineMemory(windowSize) + 6*window
+}
+
+// MemoryUsage returns the approximate memory held by Paulstretch, in bytes: the native memory of the libpaulstretch
+// instances of each channel (or of the pure Go implementation when cgo is disabled), and the Go buffers of
+// Paulstretch, of a window each: the buffers of Write and Read, the last window written for Freeze, the buffers
+// to deinterleave the input and interleave the output of multichannel audio, and those of WithOnsetSensitivity,
+// WithPitchShift, WithOutputBuffers (each of its windows), and WithLimiter (its look-ahead). The buffers returned
+// by ReleaseBuffers are no longer counted.
+//
+// The buffers for the occasional conversions of the samples, for example to another byte order, are not counted,
+// nor is the stretched audio held by WithSeamlessLoop until Close, of 4 bytes per sample of stretched audio.
+func (p *Paulstretch) MemoryUsage() int64 {
+	if !p.initialized() {
+		return 0
+	}
+	window := int64(p.windowSize) * int64(p.channels) * 4
+	// the last window written
+	memory := window
+	for _, e := range p.ps {
+		memory += engineUsage(e, p.windowSize)
+	}
+	if !p.direct {
+		memory += 3 * window
+	}
+	if p.onset != nil {
+		memory += window
+	}
+	if p.pitch != nil {
+		memory += window
+	}
+	if p.finisher != nil && p.finisher.limiter != nil {
+		memory += int64(p.finisher.limiter.getLookahead()) * (int64(p.channels)*4 + 2*8)
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if !p.released {
+		memory += 2 * window
+		if p.ring != nil {
+			memory += int64(p.ring.size) * window
+		}
+	}
+	return memory
+}
+
+// engineUsage returns the approximate memory held by an engine of a window size, in bytes.
+func engineUsage(e engine, windowSize int) int64 {
+	switch e := e.(type) {
+	case *passEngine:
+		return int64(len(e.window)) * 4
+	case *workerEngine:
+		return engineUsage(e.e, windowSize)
+	default:
+		return engineMemory(windowSize)
+	}
+}
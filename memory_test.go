@@ -0,0 +1,27 @@
+package paulstretch
+
+import "testing"
+
+func TestMemoryUsage(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		p := NewPaulstretchWithOptions(2, testWindowSize, WithChannels(channels))
+		usage, max := p.MemoryUsage(), MaxMemoryForWindow(testWindowSize, channels)
+		if usage <= int64(channels)*engineMemory(testWindowSize) || usage > max {
+			t.Errorf("%d channels: got MemoryUsage %d, want more than the engines and at most %d", channels, usage, max)
+		}
+		buffered := NewPaulstretchWithOptions(2, testWindowSize, WithChannels(channels), WithOutputBuffers(4))
+		single := NewPaulstretchWithOptions(2, testWindowSize, WithChannels(channels), WithOutputBuffers(1))
+		if got, want := buffered.MemoryUsage()-single.MemoryUsage(), 3*testWindowSize*int64(channels)*4; got != want {
+			t.Errorf("%d channels: got %d more bytes for 3 more windows of WithOutputBuffers, want %d", channels, got, want)
+		}
+		single.Close()
+		p.ReleaseBuffers()
+		if released := p.MemoryUsage(); released >= usage {
+			t.Errorf("%d channels: got MemoryUsage %d after ReleaseBuffers, want less than %d", channels, released, usage)
+		}
+		buffered.Close()
+	}
+	if MaxMemoryForWindow(2*testWindowSize, 2) <= MaxMemoryForWindow(testWindowSize, 2) {
+		t.Error("MaxMemoryForWindow does not grow with the window size")
+	}
+}
@@ -0,0 +1,28 @@
+package paulstretch
+
+// onsetFloor is the minimum high-frequency energy of a window for it to be detected as an onset,
+// so that noise in quiet parts is not detected as onsets.
+const onsetFloor = 1e-6
+
+// onsetDetector detects onsets in windows of interleaved frames, from the increase of
+// their high-frequency energy relative to the previous window.
+type onsetDetector struct {
+	sensitivity float64
+	energy      float64 // high-frequency energy of the previous window
+}
+
+// detect returns whether the window of interleaved frames contains an onset.
+func (d *onsetDetector) detect(frames []float32, channels int) bool {
+	// the energy of the first difference of the signal emphasizes high frequencies
+	e := 0.0
+	for i := channels; i < len(frames); i++ {
+		diff := float64(frames[i] - frames[i-channels])
+		e += diff * diff
+	}
+	e /= float64(len(frames))
+	prev := d.energy
+	d.energy = e
+	// the energy must increase by a factor from 2 (maximal sensitivity) to 10 (minimal sensitivity)
+	ratio := 2 + 8*(1-d.sensitivity)
+	return e > onsetFloor && e > prev*ratio
+}
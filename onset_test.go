@@ -0,0 +1,60 @@
+package paulstretch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// silentEngine is an engine that returns a window of silence for each written window, so that only
+// the unstretched windows mixed in at the detected onsets are audible.
+type silentEngine struct {
+	identityEngine
+}
+
+func (e *silentEngine) read() ([]float32, bool) {
+	window, ok := e.identityEngine.read()
+	for i := range window {
+		window[i] = 0
+	}
+	return window, ok
+}
+
+func TestOnsetSensitivity(t *testing.T) {
+	// silence, then a transient of high-frequency energy in the fourth window, then silence
+	samples := make([]float32, 8*testWindowSize)
+	transient := samples[3*testWindowSize : 4*testWindowSize]
+	for i := range transient {
+		transient[i] = 0.8 * float32(1-2*(i%2))
+	}
+	stretch := func(newEngine func() engine, opts ...Option) []float32 {
+		p := NewPaulstretchWithOptions(1, testWindowSize, opts...)
+		p.ps[0].destroy()
+		p.ps[0] = newEngine()
+		return stretchAll(t, p, samples, func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+	}
+
+	const sensitivity = 0.5
+	silent := func() engine { return &silentEngine{} }
+	got := stretch(silent, WithOnsetSensitivity(sensitivity))
+	if len(got) != len(samples) {
+		t.Fatalf("got %d stretched samples, want %d", len(got), len(samples))
+	}
+	for i, v := range got {
+		// the transient is mixed unstretched into the output of its window, in proportion to the sensitivity
+		want := float32(0)
+		if i/testWindowSize == 3 {
+			want = sensitivity * samples[i]
+		}
+		if v != want {
+			t.Fatalf("got sample %v at %d, want %v", v, i, want)
+		}
+	}
+
+	// a sensitivity of 0 disables onset detection: the transient is not mixed in
+	if got, want := stretch(silent, WithOnsetSensitivity(0)), stretch(silent); !reflect.DeepEqual(got, want) {
+		t.Error("got stretched samples with a sensitivity of 0 different from those without onset detection")
+	}
+}
@@ -0,0 +1,374 @@
+package paulstretch
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Option is an optional setting of a Paulstretch, passed to NewPaulstretchWithOptions.
+type Option func(*options)
+
+type options struct {
+	channels         int
+	byteOrder        binary.ByteOrder
+	onsetSensitivity float64
+	pitchShift       float64
+	outputBuffers    int
+	envelope         func(inputSample int64) float64
+	gain             float64
+	resampleStep     float64 // input frames per resampled frame, 0 if disabled
+	dcBlock          bool
+	fadeIn           int
+	fadeOut          int
+	sanitize         bool
+	clampInput       bool
+	maxOutput        int64
+	workers          int
+	underrunSilence  bool
+	limiter          float64 // ceiling, 0 if disabled
+	loop             int     // frames of the crossfade, 0 if disabled
+	inRange          *sampleRange
+	outRange         *sampleRange
+	dither           DitherKind
+	stretchChanges   bool
+	downmix          bool
+}
+
+func defaultOptions() options {
+	return options{
+		channels:  1,
+		byteOrder: nativeOrder,
+		gain:      1,
+	}
+}
+
+// WithChannels sets the number of channels of the audio, by default 1 (mono).
+//
+// Samples of multichannel audio are interleaved: a stream of frames, each containing one sample
+// per channel. Each channel is stretched separately, with the same parameters.
+//
+// channels must be greater than or equal to 1, other values are ignored.
+func WithChannels(channels int) Option {
+	return func(o *options) {
+		if channels >= 1 {
+			o.channels = channels
+		}
+	}
+}
+
+// WithByteOrder sets the byte order of the samples written to and read from Paulstretch
+// as bytes, by default the native byte order.
+//
+// WriteSamples and ReadSamples are not affected by the byte order, since they handle samples
+// rather than bytes.
+func WithByteOrder(order binary.ByteOrder) Option {
+	return func(o *options) {
+		if order != nil {
+			o.byteOrder = order
+		}
+	}
+}
+
+// WithOnsetSensitivity sets the sensitivity of the onset detection, from 0 (disabled, the default) to 1 (maximal).
+//
+// Paulstretch smears everything it stretches, including transients such as drum hits and consonants.
+// When onset detection is enabled, windows of input starting with a sudden increase of high-frequency energy
+// are detected as onsets, and are mixed unstretched into the first stretched window produced from them,
+// so that the attack of the transient stays audible at high stretch factors. Higher sensitivities detect
+// weaker onsets and mix more of the original transient into the output.
+//
+// sensitivity is clamped to [0, 1].
+func WithOnsetSensitivity(sensitivity float64) Option {
+	return func(o *options) {
+		o.onsetSensitivity = math.Max(0, math.Min(1, sensitivity))
+	}
+}
+
+// WithPitchShift sets the pitch shift of the stretched audio, in semitones, by default 0 (disabled).
+// Positive values shift the pitch up, negative values shift it down.
+//
+// The pitch is shifted by stretching the audio more (or less), then resampling the stretched audio
+// back to the requested stretch factor, in a single pass. Large shifts degrade the quality of the audio,
+// and large upward shifts can add aliasing. Since the audio is stretched by the stretch factor times
+// 2^(semitones/12) before resampling, shifting down requires a stretch factor large enough for this
+// product to stay greater than or equal to 1.0.
+//
+// semitones is clamped to [-24, 24].
+func WithPitchShift(semitones float64) Option {
+	return func(o *options) {
+		o.pitchShift = math.Max(-24, math.Min(24, semitones))
+	}
+}
+
+// WithOutputBuffers sets the number of windows of stretched audio that Paulstretch buffers, by default 0.
+//
+// By default, Write blocks until all the stretched audio of the previously written window is read, which
+// applies back-pressure on the writer as soon as the reader falls behind. With output buffers, the stretched
+// audio is moved to the buffers as soon as a window is written, and Write only blocks when all buffers are full,
+// which smoothes the throughput of bursty writers and readers, at the cost of memory.
+//
+// Values lower than 0 are ignored.
+func WithOutputBuffers(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.outputBuffers = n
+		}
+	}
+}
+
+// WithStretchEnvelope sets a time-varying stretch factor, by default none (the stretch factor is constant).
+//
+// fn is called once per window of input, with the position of the start of the window in the input stream,
+// in frames (samples per channel) since the first sample written to Paulstretch, and returns the local stretch
+// factor for this window, which replaces the stretch factor passed to NewPaulstretchWithOptions. This lets
+// the stretch factor follow ramps, LFOs or keyframed automation, for example a ramp from 1 to 50 over a clip.
+//
+// Since libpaulstretch uses a constant stretch factor, Paulstretch stretches with a factor of 1 and repeats
+// each window of input as many times as its local stretch factor, carrying fractions of windows over
+// to the next windows: the local stretch factor therefore has a resolution of one window.
+// Returned values lower than 1.0 (or NaN) are clamped to 1.0, and values greater than 1e6 to 1e6.
+// WithPitchShift is supported with a stretch envelope for upward shifts only: downward shifts are ignored.
+//
+// fn is called from Write and Flush, and must not call them. A nil fn is ignored.
+func WithStretchEnvelope(fn func(inputSample int64) float64) Option {
+	return func(o *options) {
+		if fn != nil {
+			o.envelope = fn
+		}
+	}
+}
+
+// WithStretchChanges lets the stretch factor be changed with QueueStretchChange, starting from the stretch factor
+// passed to NewPaulstretchWithOptions, as a stretch envelope that is constant between the queued changes.
+// The stretch factor then has the resolution and limits of WithStretchEnvelope. It is ignored with WithStretchEnvelope,
+// whose stretch envelope can also be changed with QueueStretchChange.
+func WithStretchChanges() Option {
+	return func(o *options) {
+		o.stretchChanges = true
+	}
+}
+
+// WithGain sets a fixed gain applied to the stretched audio, in decibels, by default 0 (no gain).
+//
+// Paulstretch changes the level of the audio, depending on the audio and the window size, so that
+// the stretched audio often needs to be amplified or attenuated. With a gain, stretched samples
+// are multiplied by 10^(db/20), and clipped to [-1, 1] so that amplified peaks do not overflow.
+//
+// Normalizing the stretched audio to a peak is not supported, since finding the peak requires
+// stretching the whole audio before returning any of it, which defeats streaming: the gain can instead
+// be computed from the peak of a first Stretch of the audio, or the output can be normalized afterwards.
+func WithGain(db float64) Option {
+	return func(o *options) {
+		o.gain = math.Pow(10, db/20)
+	}
+}
+
+// WithResample sets the sample rate of the audio written to Paulstretch, in Hz, and the sample rate of
+// the audio it is stretched at, by default none (the audio is not resampled).
+//
+// The written audio is resampled from inputRate to outputRate before stretching, so that the window size,
+// for example from WindowSizeForDuration, and the stretched audio read from Paulstretch are both at outputRate.
+// The audio is resampled with cubic interpolation, which delays it by a couple of frames: a couple of input
+// frames at the very end of the stream are only partly resampled when flushed.
+//
+// Equal rates disable resampling, and the written audio is passed as is. Rates lower than or equal to 0 are ignored.
+func WithResample(inputRate, outputRate int) Option {
+	return func(o *options) {
+		if inputRate <= 0 || outputRate <= 0 {
+			return
+		}
+		if inputRate == outputRate {
+			o.resampleStep = 0
+		} else {
+			o.resampleStep = float64(inputRate) / float64(outputRate)
+		}
+	}
+}
+
+// WithDCBlock removes the DC offset of the stretched audio, which extreme stretches can accumulate, by default disabled.
+//
+// The stretched audio is filtered with a one-pole high-pass filter with a cutoff frequency of about 3.5 Hz
+// at 44.1 kHz. The filter adds no latency in samples, but delays the lowest frequencies very slightly.
+func WithDCBlock() Option {
+	return func(o *options) {
+		o.dcBlock = true
+	}
+}
+
+// WithFade fades the stretched audio in over its first inFrames frames (samples per channel), and out over
+// its last outFrames frames, to avoid clicks at the very start and end of the stretched audio, by default 0 (no fade).
+//
+// Since the end of the stretched audio is only known once Paulstretch is closed, the last outFrames frames
+// of stretched audio are held back until Close is called, at which point Read returns them, faded out.
+// The fade out thus adds a latency of outFrames frames, and is not applied by ProcessWindow.
+//
+// Values lower than 0 are ignored.
+func WithFade(inFrames, outFrames int) Option {
+	return func(o *options) {
+		if inFrames >= 0 {
+			o.fadeIn = inFrames
+		}
+		if outFrames >= 0 {
+			o.fadeOut = outFrames
+		}
+	}
+}
+
+// WithSanitizeInput replaces the non-finite samples (NaN and infinities) written to Paulstretch with 0,
+// by default disabled. If clamp is true, the finite samples are also clamped to [-1, 1].
+//
+// A single non-finite sample, for example from a bad decode, spreads to the whole spectrum of its window,
+// and from there to all the stretched audio that follows, which becomes NaN. Sanitizing the input prevents this,
+// and the number of samples replaced or clamped is reported in Stats. Sanitizing costs a check per sample.
+func WithSanitizeInput(clamp bool) Option {
+	return func(o *options) {
+		o.sanitize = true
+		o.clampInput = clamp
+	}
+}
+
+// WithMaxOutputSamples limits the stretched audio read from Paulstretch to n samples (counting the samples
+// of all channels), by default 0 (unlimited), as a safety valve against runaway stretch factors in automated pipelines.
+//
+// Once n samples were read, Read returns ErrOutputLimitExceeded as soon as more stretched audio is available,
+// instead of reading it, or EOF as usual if Paulstretch is closed and all stretched audio was read.
+// The last Read call before the limit is shortened, so that exactly n samples are read. Since the written
+// samples are then no longer stretched, Write blocks until Close is called, as when Read is no longer called.
+//
+// Values lower than 0 are ignored.
+func WithMaxOutputSamples(n int64) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.maxOutput = n
+		}
+	}
+}
+
+// WithSharedWorkers makes the calls to libpaulstretch that stretch the audio of Paulstretch from n worker goroutines locked to OS threads,
+// shared by all instances created with the same n, by default 0 (calls are made by the goroutines calling
+// Write and Read).
+//
+// Each call to libpaulstretch occupies an OS thread until it returns: with many concurrent instances, for example
+// thousands of streams of a server, the calls made by the goroutines calling Write and Read each pin a thread,
+// which can create many threads and thrash the scheduler. With WithSharedWorkers, at most n threads make
+// calls to libpaulstretch, and the goroutines of the instances only wait for them, without occupying a thread.
+// The tradeoff is a handoff between goroutines on each call, which is small compared to the FFTs of a window,
+// and that the stretching of all instances is limited to n threads: n is typically about GOMAXPROCS.
+// The workers run for the lifetime of the process. With cgo disabled, the pure Go implementation is also run
+// by the workers, which then only limits the concurrency of the stretching.
+//
+// Values lower than 0 are ignored.
+func WithSharedWorkers(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.workers = n
+		}
+	}
+}
+
+// WithUnderrunSilence makes Read return silence instead of blocking when no stretched audio is available yet,
+// by default disabled, so that a soft real-time output loop keeps its stream clocked when the stretching
+// falls behind.
+//
+// Read then fills its whole buffer with silence, and the number of such underruns is reported in Stats.
+// Read still returns EOF once Paulstretch is closed and all stretched audio was read. The silence is inserted
+// into the stretched audio, so it is not counted in SamplesRead, nor in the limit of WithMaxOutputSamples.
+// WithUnderrunSilence has no effect with SetSource, since Read then stretches the audio it needs itself.
+func WithUnderrunSilence() Option {
+	return func(o *options) {
+		o.underrunSilence = true
+	}
+}
+
+// WithLimiter limits the stretched audio so that its samples never exceed a ceiling in dB (relative to full scale,
+// so that 0 is a ceiling of 1), with a look-ahead brick-wall limiter, by default disabled. The ceiling is clamped
+// to [-40, 0] dB.
+//
+// Extreme stretches can swing widely in level, and clip on playback. The limiter lowers the gain smoothly just
+// before each peak above the ceiling, and recovers it over about 50 ms afterwards, which is inaudible for most
+// peaks. Its look-ahead of 256 frames (about 6 ms at 44.1 kHz) delays the stretched audio, which starts with
+// 256 frames of silence: this is reflected in Latency and EstimateOutputSamples, and the last 256 frames are
+// returned once Paulstretch is closed (they are not returned by ProcessWindow). The look-ahead can be adjusted
+// afterwards with SetLookahead. The limiter is applied after WithGain and WithDCBlock, and before WithFade.
+func WithLimiter(ceilingDB float64) Option {
+	return func(o *options) {
+		o.limiter = math.Pow(10, math.Max(-40, math.Min(0, ceilingDB))/20)
+	}
+}
+
+// WithSeamlessLoop makes the stretched audio loop seamlessly, by crossfading its last crossfadeFrames frames
+// (samples per channel) into its first frames, by default disabled. This is meant for stretching a single clip
+// into a long ambient bed played in a loop, whose loop point would otherwise click.
+//
+// The end of the stretched audio is only known once Paulstretch is closed, so this mode does not stream:
+// all the stretched audio is buffered in memory, and Read only returns it once Close is called. The crossfaded
+// frames are removed from the end, so the stretched audio is crossfadeFrames frames shorter, which LoopLength
+// returns once it is known. The crossfade is at most half the stretched audio, for short audio.
+// WithSeamlessLoop replaces WithFade, since a fade would make the loop point audible, and is not applied
+// by ProcessWindow.
+//
+// Values lower than or equal to 0 disable the loop.
+func WithSeamlessLoop(crossfadeFrames int) Option {
+	return func(o *options) {
+		o.loop = 0
+		if crossfadeFrames > 0 {
+			o.loop = crossfadeFrames
+		}
+	}
+}
+
+// WithInputRange sets the range of the samples written to Paulstretch, by default [-1, 1], for producers
+// of samples in another range, such as [0, 1]. The samples written are mapped linearly from [min, max]
+// to [-1, 1] before they are stretched, and clamped to [min, max]: samples outside the declared range
+// are stretched as min or max. The padding of Flush is the center of the range, which is silence.
+//
+// The range only applies to the samples written with Write (and WriteSamples and the other variants),
+// not to ProcessWindow. A range where min is not lower than max is ignored.
+func WithInputRange(min, max float64) Option {
+	return func(o *options) {
+		o.inRange = newSampleRange(min, max)
+	}
+}
+
+// WithDither adds dither of a kind to the stretched samples read with ReadInt24Samples and ReadInt16Samples,
+// before they are quantized to integers, by default DitherNone.
+//
+// Rounding the stretched samples to integers adds a quantization error that follows the signal, which is audible
+// as distortion in quiet passages, and stretched audio spends a lot of time at low levels, in long fade outs
+// and tails. Dither replaces this distortion with a constant, benign noise floor of about 1 LSB, far below
+// the signal at these bit depths. DitherTriangular is the usual choice. The dither is pseudo-random with
+// a fixed seed, so that the dithered output of a stream is deterministic. See WAVWriter.SetDither for 16-bit output.
+func WithDither(kind DitherKind) Option {
+	return func(o *options) {
+		o.dither = kind
+	}
+}
+
+// WithOutputRange sets the range of the stretched samples read from Paulstretch, by default [-1, 1],
+// for consumers of samples in another range, such as shaders or DACs expecting samples in [0, 1].
+// The stretched samples are clamped to [-1, 1], then mapped linearly to [min, max], so that the samples read
+// are always in the range. Silence, as returned with WithUnderrunSilence, is the center of the range.
+//
+// The range only applies to the samples read with Read (and ReadSamples and the other variants),
+// not to ProcessWindow. A range where min is not lower than max is ignored.
+func WithOutputRange(min, max float64) Option {
+	return func(o *options) {
+		o.outRange = newSampleRange(min, max)
+	}
+}
+
+// WithDownmixToMono averages the channels of the audio written to Paulstretch, of the number of channels
+// of WithChannels, into a single channel before stretching, by default disabled: the stretched audio read
+// is then mono, for example to make a mono drone from a stereo source, at the cost of stretching one channel only.
+//
+// The channels are averaged with equal weights (each channel is scaled by 1/channels), rather than with
+// the -3 dB per channel of some mixers, so that the downmixed samples never exceed the samples written and
+// cannot clip: correlated channels keep their level, and uncorrelated channels are a few dB quieter.
+//
+// The written samples are always copied, as with WithResample, and OptimalWriteBufferSize and
+// EstimateOutputSamples count the samples of all the channels written. WithDownmixToMono has no effect on mono audio.
+func WithDownmixToMono() Option {
+	return func(o *options) {
+		o.downmix = true
+	}
+}
@@ -0,0 +1,27 @@
+package paulstretch
+
+import "encoding/binary"
+
+// Parameters are the parameters a Paulstretch was created with, as returned by Paulstretch.Parameters.
+type Parameters struct {
+	// StretchFactor is the stretch factor passed to NewPaulstretch or NewPaulstretchWithOptions.
+	// With WithStretchEnvelope, the stretch factor is set by the envelope instead.
+	StretchFactor float64
+	// WindowSize is the size of the stretching window, in samples per channel, at least 128 (see NewPaulstretch).
+	WindowSize int
+	// Channels is the number of interleaved channels of the audio, see WithChannels.
+	Channels int
+	// ByteOrder is the byte order of the samples written and read as bytes, see WithByteOrder.
+	ByteOrder binary.ByteOrder
+}
+
+// Parameters returns the parameters Paulstretch was created with, for example to log its configuration
+// or to size buffers for its audio.
+func (p *Paulstretch) Parameters() Parameters {
+	return Parameters{
+		StretchFactor: p.stretchFactor,
+		WindowSize:    p.windowSize,
+		Channels:      p.channels,
+		ByteOrder:     p.byteOrder,
+	}
+}
@@ -1,28 +1,45 @@
 /*
 go-paulstretch are Go bindings to libpaulstretch, tiny & portable implementation of the Paulstretch extreme audio stretching algorithm.
 
-Audio format
+When cgo is disabled, for example when cross-compiling or when libpaulstretch cannot be installed, go-paulstretch
+uses a pure Go implementation of the algorithm instead, with the same API. It is slower than
+libpaulstretch, and since the phases of the stretched audio are random, its output is not identical to that
+of libpaulstretch, but it sounds alike, with a similar level, and has the same length to within a window.
+It also starts the stretched audio with a fade in, over the first half window of input.
+
+# Audio format
 
 go-paulstretch uses streams of mono uncompressed 32-bit float samples, in native endianness.
 
-Usage
+Multichannel audio, as interleaved frames of samples, and other byte orders are supported with
+the WithChannels and WithByteOrder options of NewPaulstretchWithOptions.
+
+# Usage
 
 To stretch a sound, create a Paulstretch instance with NewPaulstretch. Paulstretch supports the Reader, Writer and Closer interfaces to provide a pipe-like interface with a stream of audio samples as input and a stream of stretched audio samples as output.
 
-Concurrency
+# Concurrency
+
+The functions of this package are safe for concurrent use, with one exception: the methods writing samples
+(Write, WriteSamples, WriteOnce, WriteAligned, WriteBatch, the converting writers such as WriteInt16Samples
+and WriteSamples64, and Flush) share the input buffers of Paulstretch and are not serialized, so they must not
+be called concurrently with each other, for example by writing from a single goroutine. They can be called
+concurrently with Read, as with a pipe.
 
-All functions of this package are completely safe for concurrent use.
+Concurrent calls to Read and its variants (ReadSamples, TryRead, ...) are serialized: each call reads a contiguous
+part of the stretched audio, in an unspecified order.
 */
 package paulstretch
 
-// #cgo pkg-config: paulstretch
-// #include <paulstretch.h>
-import "C"
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
-	"reflect"
+	"math"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -33,94 +50,470 @@ import (
 // Paulstretch supports the Reader, Writer and Closer interfaces, used to write a stream of
 // audio samples and get back a stream of stretched audio samples.
 type Paulstretch struct {
-	ps          C.paulstretch
-	writeBuf    []byte
-	writeOff    int
-	readBuf     []byte
-	readOff     int
-	closed      bool
-	rwCond      sync.Cond
-	writePermit chan struct{}
+	stats         stats  // first for 64-bit alignment of atomic counters
+	levels        levels // right after stats, whose size is a multiple of 8 bytes, for the same alignment
+	ps            []engine
+	stretchFactor float64
+	windowSize    int
+	channels      int
+	byteOrder     binary.ByteOrder
+	direct        bool // mono native-endian audio without processing, passed as is to and from the C instance
+	inFrames      []float32
+	inSamples     [][]float32
+	outSamples    [][]float32
+	outFrames     []float32
+	onset         *onsetDetector
+	dry           []float32
+	dryMix        float32
+	pitch         *resampler
+	pitched       []float32
+	ring          *outputRing
+	envelope      *stretchEnvelope
+	gain          float32      // 1 if no gain is applied
+	inRange       *sampleRange // nil for [-1, 1]
+	outRange      *sampleRange // nil for [-1, 1]
+	dither        *ditherer    // nil without WithDither
+	inResampler   *resampler
+	downmix       int // channels of the frames written, averaged to mono frames, 0 if disabled
+	finisher      *finisher
+	ending        bool // the window made available is the end held back by finisher
+	source        io.Reader
+	sourceEnd     bool  // the window in writeBuf is the last one of the source
+	closeErr      error // error of the source or of CloseWithError, returned by Read instead of EOF
+	sanitize      bool
+	clampInput    bool
+	maxOutput     int64     // maximum number of bytes read, 0 if unlimited
+	underrun      bool      // Read returns silence instead of blocking
+	resampleIn    []byte    // written bytes not yet resampled, less than a frame
+	resampleBuf   []float32 // input frames and resampled frames
+	resampled     []byte    // resampled samples not yet written, after an error
+	scratch       []byte
+	writeConv     []float32  // samples converted by WriteSamples64 and WriteInt24Samples
+	readConv      []float32  // samples read by ReadSamples64 and ReadInt24Samples
+	readMu        sync.Mutex // serializes the calls to Read and its variants, which use readBuf and readOff
+	writeBuf      []byte
+	writeOff      int
+	readBuf       []byte
+	readOff       int
+	closed        bool
+	released      bool
+	users         int // Write, Flush and Read calls in progress, using the internal buffers
+	rwCond        sync.Cond
+	writePermit   chan struct{}
+	permitted     bool // a write permit was granted, and its window is not written yet, see grantPermit
+	preloaded     bool // outSamples holds a window read after the last one was emitted, see preload
+
+	readDeadline  time.Time
+	readTimer     *time.Timer
+	writeDeadline time.Time
+	writeTimer    *time.Timer
+	writeWake     chan struct{} // closed and replaced when the write deadline changes or is exceeded
+
+	frozen bool        // Freeze was called: the last window is written again instead of new windows
+	last   [][]float32 // last window written to the engines, per channel
+
+	completed  bool // all stretched audio was read after Close, see OnComplete
+	onComplete []func(err error)
+	taps       atomic.Value // []*tap, see Tap
+	canceled   int32        // Cancel was called, accessed atomically
+	markers    markers
+	destroyed  bool // the engines were destroyed by Cancel
+
+	priming bool  // Prime is submitting windows of silence, which are not stretched by the envelope
+	skip    int64 // frames of stretched audio of the silence of Prime not yet discarded
 }
 
 // NewPaulstretch returns a Paulstretch initialized with a stretch factor and stretching window size.
 //
 // stretchFactor is the stretching factor for the audio.
 // A stretch factor of 10 on 1 second of audio would produce approximately 10 seconds of audio.
-// stretchFactor must be greater than or equal to 1.0.
+// stretchFactor must be greater than or equal to 1.0. A stretch factor of exactly 1.0 passes the audio through
+// unchanged (except for the other options, such as WithPitchShift), with no latency, rather than smearing
+// each window with random phases: the output is then the input, padded by Flush to a whole number of windows.
 //
 // windowSize is the size (in samples) of the window used for stretching the audio.
 // In internally corresponds to the size of the FFT run on parts of the song.
-// A window size corresponding to 0.25 seconds works best for most music.
+// A window size corresponding to 0.25 seconds works best for most music, see WindowSizeForDuration.
 // Larger values can also be used to "smear" a sound into a texture.
-// windowSize should be greater than or equal to 128.
+// windowSize should be greater than or equal to 128: smaller window sizes are clamped to 128, so that the stretching
+// window is then longer than requested (see NewPaulstretchChecked to reject them instead). Window sizes need not be
+// powers of two, since the FFT of any size is supported, but sizes whose only prime factors are small, such as those
+// returned by WindowSizeForDuration, are faster.
 func NewPaulstretch(stretchFactor float64, windowSize int) *Paulstretch {
-	ps := C.paulstretch_create(C.double(stretchFactor), C.size_t(windowSize))
+	return NewPaulstretchWithOptions(stretchFactor, windowSize)
+}
+
+// NewPaulstretchChecked is like NewPaulstretch, but validates its parameters instead of passing
+// them as is to libpaulstretch, for which invalid values are undefined behavior.
+//
+// NewPaulstretchChecked returns ErrInvalidStretchFactor if stretchFactor is less than 1.0 or is not finite,
+// and ErrInvalidWindowSize if windowSize is less than 128.
+func NewPaulstretchChecked(stretchFactor float64, windowSize int) (*Paulstretch, error) {
+	if !(stretchFactor >= 1) || math.IsInf(stretchFactor, 1) {
+		return nil, ErrInvalidStretchFactor
+	}
+	if windowSize < minWindowSize {
+		return nil, ErrInvalidWindowSize
+	}
+	return NewPaulstretch(stretchFactor, windowSize), nil
+}
+
+// NewPaulstretchWithOptions returns a Paulstretch initialized with a stretch factor, stretching window size,
+// and additional options.
+//
+// stretchFactor and windowSize are the same as for NewPaulstretch. Options not passed keep their default value,
+// so that NewPaulstretchWithOptions without any option is the same as NewPaulstretch.
+func NewPaulstretchWithOptions(stretchFactor float64, windowSize int, opts ...Option) *Paulstretch {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if windowSize < minWindowSize {
+		windowSize = minWindowSize
+	}
+	if o.stretchChanges && o.envelope == nil {
+		// the stretch factor before the first change
+		o.envelope = func(int64) float64 { return stretchFactor }
+	}
+	downmix := 0
+	if o.downmix && o.channels > 1 {
+		// the written frames are averaged to mono frames before anything else
+		downmix = o.channels
+		o.channels = 1
+	}
+	factor := stretchFactor
+	if o.envelope != nil {
+		// the envelope sets the stretch factor by repeating windows
+		factor = 1
+		o.pitchShift = math.Max(0, o.pitchShift)
+	}
+	// pitch shifting stretches more, then resamples the stretched audio back to the requested length
+	pitchRatio := math.Pow(2, o.pitchShift/12)
+	ps := make([]engine, o.channels)
+	for i := range ps {
+		if stretchFactor == 1 && o.envelope == nil && o.pitchShift == 0 {
+			ps[i] = newPassEngine(windowSize)
+		} else {
+			ps[i] = newEngine(factor*pitchRatio, windowSize)
+		}
+		if o.workers > 0 {
+			ps[i] = newWorkerEngine(ps[i], sharedWorkers(o.workers))
+		}
+	}
+	readSize := windowSize
+	if o.pitchShift != 0 {
+		readSize = int(math.Ceil(float64(windowSize)/pitchRatio)) + 1
+	}
 	p := Paulstretch{
-		ps:          ps,
-		writeBuf:    make([]byte, windowSize*4),
-		writeOff:    0,
-		readBuf:     make([]byte, windowSize*4),
-		readOff:     windowSize * 4,
-		rwCond:      sync.Cond{L: &sync.Mutex{}},
-		writePermit: make(chan struct{}, 1),
+		ps:            ps,
+		stretchFactor: stretchFactor,
+		windowSize:    windowSize,
+		channels:      o.channels,
+		byteOrder:     o.byteOrder,
+		direct:        o.channels == 1 && o.byteOrder == nativeOrder && o.onsetSensitivity == 0 && o.pitchShift == 0 && o.outputBuffers == 0 && o.gain == 1 && o.resampleStep == 0 && !o.dcBlock && o.limiter == 0 && o.fadeIn == 0 && o.fadeOut == 0 && o.loop == 0 && !o.sanitize && o.inRange == nil && o.outRange == nil && downmix == 0,
+		writeBuf:      getBuffer(windowSize * o.channels * 4)[:windowSize*o.channels*4],
+		writeOff:      0,
+		readBuf:       getBuffer(readSize * o.channels * 4),
+		readOff:       0,
+		gain:          float32(o.gain),
+		inRange:       o.inRange,
+		dither:        newDitherer(o.dither),
+		outRange:      o.outRange,
+		sanitize:      o.sanitize,
+		downmix:       downmix,
+		clampInput:    o.clampInput,
+		maxOutput:     o.maxOutput * 4,
+		underrun:      o.underrunSilence,
+		outSamples:    make([][]float32, o.channels),
+		rwCond:        sync.Cond{L: &sync.Mutex{}},
+		writePermit:   make(chan struct{}, 1),
+		writeWake:     make(chan struct{}),
+	}
+	p.last = make([][]float32, o.channels)
+	for i := range p.last {
+		p.last[i] = make([]float32, windowSize)
+	}
+	if !p.direct {
+		p.inFrames = make([]float32, windowSize*o.channels)
+		p.inSamples = make([][]float32, o.channels)
+		for i := range p.inSamples {
+			p.inSamples[i] = make([]float32, windowSize)
+		}
+		p.outFrames = make([]float32, windowSize*o.channels)
+	}
+	if o.onsetSensitivity > 0 {
+		p.onset = &onsetDetector{sensitivity: o.onsetSensitivity}
+		p.dry = make([]float32, windowSize*o.channels)
+	}
+	if o.pitchShift != 0 {
+		p.pitch = newResampler(o.channels, pitchRatio)
+		p.pitched = make([]float32, 0, readSize*o.channels)
+	}
+	if o.outputBuffers > 0 {
+		p.ring = &outputRing{size: o.outputBuffers}
+	}
+	if o.envelope != nil {
+		p.envelope = &stretchEnvelope{fn: o.envelope}
+	}
+	if o.resampleStep != 0 {
+		p.inResampler = newResampler(o.channels, o.resampleStep)
+	}
+	if o.dcBlock || o.limiter > 0 || o.fadeIn > 0 || o.fadeOut > 0 || o.loop > 0 {
+		p.finisher = newFinisher(o.channels, o.dcBlock, o.limiter, o.fadeIn, o.fadeOut, o.loop)
 	}
 	p.writePermit <- struct{}{}
+	p.permitted = true
+	// the finalizer destroys the engines only once p is unreachable: the calls using them keep p reachable
+	// until they return, with the deferred call of leave registered by enter (or runtime.KeepAlive)
 	runtime.SetFinalizer(&p, func(p *Paulstretch) {
-		C.paulstretch_destroy(p.ps)
+		if !p.destroyed {
+			for _, ps := range p.ps {
+				ps.destroy()
+			}
+		}
+		p.releaseBuffers()
 	})
 	return &p
 }
 
 // Close signals Paulstretch that no other data will be written to it, and that Read
 // should return EOF instead of waiting for more stretch audio data.
+//
+// Close stops the stretching right away: the samples written that do not yet fill a full window
+// are discarded, unless Flush was called before, while the stretched audio already produced can still be read.
+// See CloseFlush to finish the stretching of all written samples instead.
 func (p *Paulstretch) Close() error {
+	if !p.initialized() {
+		return ErrClosed
+	}
 	p.rwCond.L.Lock()
 	if !p.closed {
 		p.closed = true
 		close(p.writePermit)
-		p.rwCond.Signal()
+		p.rwCond.Broadcast()
 	}
 	p.rwCond.L.Unlock()
 	return nil
 }
 
-// Write writes bytes of an audio sample stream (native-endian floats) to Paulstretch.
+// isClosed returns whether Paulstretch is closed, without the lock held.
+func (p *Paulstretch) isClosed() bool {
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	return p.closed
+}
+
+// CloseTimeout closes Paulstretch like Close, then waits for the reader to read all the stretched audio, until Read
+// returns EOF (or the error set by CloseWithError), for at most d. This prevents leaking Paulstretch and its goroutines
+// when the reader abandons the stream, for example when a network client disconnects.
+//
+// If the stretched audio is not all read after d, CloseTimeout forcibly finishes Paulstretch: the stretched audio
+// not yet read is lost, the internal buffers are released as with ReleaseBuffers, Read then returns
+// ErrDeadlineExceeded (unless an error was set by CloseWithError), and CloseTimeout returns ErrDeadlineExceeded.
+// Write and Flush return ErrClosed, as after Close. Paulstretch must then not be used anymore.
+//
+// CloseTimeout returns nil once all stretched audio was read.
+func (p *Paulstretch) CloseTimeout(d time.Duration) error {
+	if err := p.Close(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(d)
+	timer := time.AfterFunc(d, func() {
+		p.rwCond.L.Lock()
+		p.rwCond.Broadcast()
+		p.rwCond.L.Unlock()
+	})
+	defer timer.Stop()
+	p.rwCond.L.Lock()
+	for !p.completed && time.Now().Before(deadline) {
+		p.rwCond.Wait()
+	}
+	if p.completed {
+		p.rwCond.L.Unlock()
+		return nil
+	}
+	if p.closeErr == nil {
+		p.closeErr = ErrDeadlineExceeded
+	}
+	p.rwCond.L.Unlock()
+	p.ReleaseBuffers()
+	return ErrDeadlineExceeded
+}
+
+// CloseWithError closes Paulstretch like Close, and makes Read return err instead of EOF once all stretched audio
+// was read, so that the reader of a stream whose input failed, for example because of a network error, can tell
+// that the stretched audio is incomplete. It always returns nil.
+//
+// If err is nil, CloseWithError is the same as Close. Once an error is set, the errors of later calls
+// to CloseWithError are ignored.
+func (p *Paulstretch) CloseWithError(err error) error {
+	if !p.initialized() {
+		return ErrClosed
+	}
+	p.rwCond.L.Lock()
+	if p.closeErr == nil {
+		p.closeErr = err
+	}
+	p.rwCond.L.Unlock()
+	return p.Close()
+}
+
+// endErr returns the error returned by Read once Paulstretch is closed and all stretched audio was read:
+// the error of the source or of CloseWithError, if any, or EOF.
+func (p *Paulstretch) endErr() error {
+	if !p.initialized() {
+		return ErrClosed
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	p.complete()
+	if p.closeErr != nil {
+		return p.closeErr
+	}
+	return io.EOF
+}
+
+// CloseFlush finishes the stretching of all samples written to Paulstretch, then closes it: it is the same as
+// Flush followed by Close, as a single call for the graceful end of a stream.
+//
+// Like Flush, CloseFlush may block until Read is called enough times. Once it returns, Read returns the
+// remaining stretched audio, including that of the flushed samples, then EOF. If Flush fails, Paulstretch
+// is closed anyway and its error is returned, unless Paulstretch was already closed.
+func (p *Paulstretch) CloseFlush() error {
+	err := p.Flush()
+	p.Close()
+	if err == ErrClosed {
+		return nil
+	}
+	return err
+}
+
+// Write writes bytes of an audio sample stream (native-endian floats, unless WithByteOrder is used) to Paulstretch.
+// The bytes of a sample can be split across several calls to Write, for example when they are read from a socket:
+// the windows of samples are only submitted for stretching once all their bytes are written.
 //
 // Write may block until Read is called enough times, because Paulstretch does not buffer
 // stretch output samples and needs them to be read before processing new samples.
-func (p *Paulstretch) Write(data []byte) (int, error) {
-	if p.closed {
-		return 0, io.EOF
+// Write returns ErrClosed if Paulstretch is closed, including when it is closed while Write is blocked,
+// along with the number of bytes written before.
+func (p *Paulstretch) Write(data []byte) (n int, err error) {
+	defer p.canceledErr(&err)
+	if !p.enter() {
+		return 0, ErrClosed
+	}
+	defer p.leave()
+	if p.isClosed() {
+		return 0, ErrClosed
+	}
+	if p.source != nil {
+		return 0, ErrSource
+	}
+	if p.convertsInput() {
+		return p.writeResampled(data)
+	}
+	n, err = p.write(data)
+	atomic.AddInt64(&p.stats.bytesWritten, int64(n))
+	return n, err
+}
+
+// WriteOnce is like Write, but submits at most one window of samples for stretching, and returns the number
+// of bytes of data consumed rather than looping until all of data is consumed, so that callers can interleave
+// other work between windows, for cooperative scheduling.
+//
+// WriteOnce consumes the bytes that complete the current window, submits it, and returns, or buffers all of data
+// if it does not complete a window. It may thus consume less than data without an error, unlike Write: the caller
+// must then call WriteOnce again with the rest of data. Like Write, WriteOnce may block until Read is called,
+// but at most for one window. With WithResample or WithDownmixToMono, the converted windows are not known
+// in advance, and WriteOnce is the same as Write.
+func (p *Paulstretch) WriteOnce(data []byte) (n int, err error) {
+	defer p.canceledErr(&err)
+	if !p.enter() {
+		return 0, ErrClosed
+	}
+	defer p.leave()
+	if p.isClosed() {
+		return 0, ErrClosed
+	}
+	if p.source != nil {
+		return 0, ErrSource
+	}
+	if p.convertsInput() {
+		return p.writeResampled(data)
+	}
+	if c := len(p.writeBuf) - p.writeOff; len(data) > c {
+		data = data[:c]
 	}
+	n, err = p.write(data)
+	atomic.AddInt64(&p.stats.bytesWritten, int64(n))
+	return n, err
+}
+
+// WriteAligned writes exactly a window of samples, of OptimalWriteBufferSize samples, to Paulstretch, and submits it
+// as is for stretching, without copying it to an internal buffer first: this is a guaranteed zero-copy path
+// for performance-sensitive callers, that never allocates. For mono audio without processing options,
+// libpaulstretch reads the samples straight from samples, and they are otherwise only deinterleaved and processed
+// as with Write. With WithByteOrder, the samples are first converted, as with WriteSamples.
+//
+// WriteAligned returns ErrNotAligned, writing nothing, rather than falling back to copying the samples, if samples
+// is not exactly a window, or if samples written before with Write do not yet fill a window. It also returns
+// ErrNotAligned with WithResample or WithDownmixToMono, whose converted windows are not known in advance.
+// Like Write, WriteAligned may block until Read is called, and returns ErrClosed if Paulstretch is closed.
+func (p *Paulstretch) WriteAligned(samples []float32) (n int, err error) {
+	defer p.canceledErr(&err)
+	if !p.enter() {
+		return 0, ErrClosed
+	}
+	defer p.leave()
+	if p.isClosed() {
+		return 0, ErrClosed
+	}
+	if p.source != nil {
+		return 0, ErrSource
+	}
+	if p.convertsInput() || p.writeOff != 0 || len(samples) != p.windowSize*p.channels {
+		return 0, ErrNotAligned
+	}
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	if p.byteOrder != nativeOrder {
+		// convert to the byte order expected by submit, as WriteSamples does
+		if cap(p.scratch) < len(b) {
+			p.scratch = make([]byte, len(b))
+		}
+		p.scratch = p.scratch[:len(b)]
+		copy(p.scratch, b)
+		swap32(p.scratch)
+		b = p.scratch
+	}
+	if err := p.submit(b); err != nil {
+		return 0, err
+	}
+	runtime.KeepAlive(samples)
+	atomic.AddInt64(&p.stats.bytesWritten, int64(len(b)))
+	return len(samples), nil
+}
+
+// write splits data into windows, completing the samples pending in writeBuf, submits the full windows
+// and keeps the rest in writeBuf.
+func (p *Paulstretch) write(data []byte) (int, error) {
+	defer p.setBuffered()
 	n := 0
 	for p.writeOff+len(data) >= len(p.writeBuf) {
-		var buf []byte
+		// only update the offsets once the window is submitted, so that they stay consistent on error
 		c := len(p.writeBuf) - p.writeOff
+		var err error
 		if p.writeOff == 0 {
-			buf = data
-			data = data[len(p.writeBuf):]
+			// submit exactly a window, which is never empty: the loop ends when data is consumed, so data
+			// spanning exact multiples of windows leaves no empty window to submit
+			err = p.submit(data[:c])
 		} else {
-			buf = p.writeBuf
-			copy(buf[p.writeOff:], data)
-			data = data[len(p.writeBuf)-p.writeOff:]
-			p.writeOff = 0
-		}
-		sh := reflect.SliceHeader{
-			Data: uintptr(unsafe.Pointer(&buf[0])),
-			Len:  len(buf) / 4,
-			Cap:  len(buf) / 4,
-		}
-		samples := *(*[]C.float)(unsafe.Pointer(&sh))
-		<-p.writePermit
-		p.rwCond.L.Lock()
-		if p.closed {
-			p.rwCond.L.Unlock()
-			return n, io.EOF
+			copy(p.writeBuf[p.writeOff:], data)
+			err = p.submit(p.writeBuf)
 		}
-		C.paulstretch_write(p.ps, &samples[0])
-		p.rwCond.Signal()
-		p.rwCond.L.Unlock()
+		if err != nil {
+			return n, err
+		}
+		data = data[c:]
+		p.writeOff = 0
 		n += c
 	}
 	if len(data) > 0 {
@@ -131,63 +524,693 @@ func (p *Paulstretch) Write(data []byte) (int, error) {
 	return n, nil
 }
 
+// WriteFromAll writes the audio sample streams read from readers to Paulstretch, back-to-back, until each
+// returns EOF, and returns the total number of bytes written.
+//
+// The streams are stretched as one continuous stream: the samples at the end of a stream that do not fill
+// a full window are completed with the samples at the start of the next stream, so that the windows span
+// the boundaries between the streams without seams, and readers can have any length. Like after Write,
+// Flush must be called to stretch the end of the last stream.
+//
+// WriteFromAll stops at the first error, other than EOF, returned by a reader or by Write.
+func (p *Paulstretch) WriteFromAll(readers ...io.Reader) (int64, error) {
+	var written int64
+	for _, r := range readers {
+		n, err := io.Copy(p, r)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// submit waits for a write permit and writes a full window of samples from buf to the C instances.
+//
+// With a stretch envelope, the window is written several times, each after its own write permit. If submit
+// returns an error, it can be called again with the same window to write it the remaining times.
+func (p *Paulstretch) submit(buf []byte) error {
+	repeats := 1
+	if p.envelope != nil && !p.priming {
+		if p.envelope.pending == 0 {
+			p.envelope.pending = p.envelope.next(p.windowSize)
+		}
+		repeats = p.envelope.pending
+	}
+	var samples []float32
+	onset := false
+	if p.direct {
+		samples = unsafe.Slice((*float32)(unsafe.Pointer(&buf[0])), len(buf)/4)
+	} else {
+		p.input(buf)
+		onset = p.onset != nil && p.onset.detect(p.inFrames, p.channels)
+	}
+	for ; repeats > 0; repeats-- {
+		if err := p.waitWritePermit(); err != nil {
+			return err
+		}
+		p.rwCond.L.Lock()
+		for p.frozen && !p.closed {
+			// the window is written once unfrozen
+			p.rwCond.Wait()
+		}
+		if p.closed {
+			p.rwCond.L.Unlock()
+			return ErrClosed
+		}
+		if p.direct {
+			p.ps[0].write(samples)
+			copy(p.last[0], samples)
+			runtime.KeepAlive(buf)
+		} else {
+			for c, in := range p.inSamples {
+				p.ps[c].write(in)
+				copy(p.last[c], in)
+			}
+			if onset {
+				// the output of this window will be read before any other window is written
+				copy(p.dry, p.inFrames)
+				p.dryMix = float32(p.onset.sensitivity)
+				onset = false
+			}
+		}
+		// the window of the permit is written
+		p.permitted = false
+		if p.ring != nil && p.fill() {
+			// the stretched samples fit in the output buffers: let the next window be written right away
+			p.grantPermit()
+		}
+		if p.envelope != nil && !p.priming {
+			p.envelope.pending--
+		}
+		if repeats == 1 {
+			atomic.AddInt64(&p.stats.windows, 1)
+		}
+		p.rwCond.Signal()
+		p.rwCond.L.Unlock()
+	}
+	return nil
+}
+
+// input decodes a window of interleaved frames from buf into inFrames, and deinterleaves them into inSamples.
+func (p *Paulstretch) input(buf []byte) {
+	for i := range p.inFrames {
+		p.inFrames[i] = math.Float32frombits(p.byteOrder.Uint32(buf[i*4:]))
+	}
+	if p.inRange != nil {
+		for i, v := range p.inFrames {
+			p.inFrames[i] = p.inRange.toUnit(v)
+		}
+	}
+	if p.sanitize {
+		p.sanitizeInput()
+	}
+	p.deinterleave()
+}
+
+// sanitizeInput replaces the non-finite samples of inFrames with 0, and clamps the others if clampInput is set.
+func (p *Paulstretch) sanitizeInput() {
+	n := 0
+	for i, v := range p.inFrames {
+		if f := float64(v); math.IsNaN(f) || math.IsInf(f, 0) {
+			p.inFrames[i] = 0
+			n++
+		} else if p.clampInput && (v < -1 || v > 1) {
+			p.inFrames[i] = float32(math.Max(-1, math.Min(1, f)))
+			n++
+		}
+	}
+	if n > 0 {
+		atomic.AddInt64(&p.stats.sanitized, int64(n))
+	}
+}
+
+// deinterleave deinterleaves the window of frames of inFrames into inSamples.
+func (p *Paulstretch) deinterleave() {
+	for i := range p.inSamples[0] {
+		for c, in := range p.inSamples {
+			in[i] = p.inFrames[i*p.channels+c]
+		}
+	}
+}
+
+// Flush pads the samples written to Paulstretch that do not yet fill a full window with silence,
+// and submits them for stretching, so that Read can return the stretched end of the stream.
+//
+// Because of the padding, up to a window of silence (before stretching) is added after the
+// flushed samples. Flush is typically called once, after the last Write and before Close, in
+// which case this silence ends up at the very end of the stretched audio.
+//
+// Flush does nothing if no samples are pending, so calling it several times is harmless. The bytes of a last,
+// incomplete sample are discarded. Like Write, Flush may block until Read is called enough times, and returns ErrClosed if Paulstretch is closed.
+func (p *Paulstretch) Flush() (err error) {
+	defer p.canceledErr(&err)
+	if !p.enter() {
+		return ErrClosed
+	}
+	defer p.leave()
+	if p.source != nil {
+		return ErrSource
+	}
+	if len(p.resampled) > 0 {
+		if err := p.writePending(); err != nil {
+			return err
+		}
+	}
+	// discard the bytes of an incomplete sample, rather than completing it with the padding
+	p.writeOff &^= 3
+	if p.writeOff == 0 {
+		return nil
+	}
+	if p.inRange != nil {
+		// pad with silence, at the center of the range
+		center := math.Float32bits(float32((p.inRange.min + p.inRange.max) / 2))
+		for i := p.writeOff; i < len(p.writeBuf); i += 4 {
+			p.byteOrder.PutUint32(p.writeBuf[i:], center)
+		}
+	} else {
+		for i := p.writeOff; i < len(p.writeBuf); i++ {
+			p.writeBuf[i] = 0
+		}
+	}
+	if err := p.submit(p.writeBuf); err != nil {
+		return err
+	}
+	p.writeOff = 0
+	p.setBuffered()
+	return nil
+}
+
 // WriteSamples is a utility function that eventually calls Write with this sample array.
 //
 // WriteSamples returns the number of samples written to Paulstretch and any underlying error
 // encountered during Write.
 func (p *Paulstretch) WriteSamples(samples []float32) (int, error) {
-	sh := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(&samples[0])),
-		Len:  len(samples) * 4,
-		Cap:  len(samples) * 4,
+	if len(samples) == 0 {
+		return 0, nil
 	}
-	b := *(*[]byte)(unsafe.Pointer(&sh))
-	n, err := p.Write(b)
+	n, err := p.Write(p.sampleBytes(samples))
+	runtime.KeepAlive(samples)
 	return n / 4, err
 }
 
-// Read reads bytes of the stretched audio sample stream (native-endian floats) from Paulstretch.
+// sampleBytes returns the bytes of samples, which must not be empty, in the byte order expected by Write: samples
+// themselves, or a copy in scratch with WithByteOrder, so that samples is not modified.
+func (p *Paulstretch) sampleBytes(samples []float32) []byte {
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	if p.byteOrder != nativeOrder {
+		if cap(p.scratch) < len(b) {
+			p.scratch = make([]byte, len(b))
+		}
+		p.scratch = p.scratch[:len(b)]
+		copy(p.scratch, b)
+		swap32(p.scratch)
+		b = p.scratch
+	}
+	return b
+}
+
+// Read reads bytes of the stretched audio sample stream (native-endian floats, unless WithByteOrder is used) from Paulstretch.
 //
 // Read may block until Write is called enough times, as a pipe-like behviour, since Paulstretch
 // uses the written audio samples to generate the stretched ones.
+//
+// Read only blocks until some stretched audio is available, then fills as much of data as possible
+// with the stretched audio immediately available, across windows, without waiting for more: a large data
+// is filled with several windows of stretched audio at once if they are available.
+//
+// Read with an empty data never blocks: it returns EOF if Paulstretch is closed and all stretched audio
+// was read, and 0 and a nil error otherwise.
 func (p *Paulstretch) Read(data []byte) (int, error) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	return p.readAvailable(data)
+}
+
+// readAvailable implements Read, with readMu held.
+func (p *Paulstretch) readAvailable(data []byte) (int, error) {
+	n, err := p.readSome(data)
+	if err != nil || n == 0 || n == len(data) || !p.enter() {
+		p.observe(data[:n])
+		return n, err
+	}
+	defer p.leave()
+	defer func() {
+		p.observe(data[:n])
+	}()
+	for n < len(data) {
+		more, limited := p.limit(data[n:])
+		if limited {
+			break
+		}
+		if p.readOff < len(p.readBuf) {
+			m := copy(more, p.readBuf[p.readOff:])
+			p.advance(m)
+			n += m
+			continue
+		}
+		p.rwCond.L.Lock()
+		if !p.available() {
+			// let the next window be written while data is returned
+			p.grantPermit()
+			p.rwCond.L.Unlock()
+			break
+		}
+		n += p.emit(more)
+	}
+	return n, nil
+}
+
+// observe updates the output levels with data, just read, and copies it to the taps.
+func (p *Paulstretch) observe(data []byte) {
+	if len(data) == 0 || !p.initialized() {
+		return
+	}
+	p.meter(data)
+	p.tap(data)
+	p.passMarkers()
+}
+
+// readSome implements Read, reading the stretched audio of at most one window.
+func (p *Paulstretch) readSome(data []byte) (int, error) {
+	if !p.enter() {
+		return 0, p.endErr()
+	}
+	defer p.leave()
+	data, limited := p.limit(data)
+	if limited {
+		return 0, p.limitErr()
+	}
 	if p.readOff < len(p.readBuf) {
 		n := copy(data, p.readBuf[p.readOff:])
-		p.readOff += n
+		p.advance(n)
 		return n, nil
 	}
 	if len(data) == 0 {
+		// do not block, but report EOF if all stretched audio was read
+		if _, ok, closed := p.tryRead(data); !ok && closed {
+			return 0, p.endErr()
+		}
 		return 0, nil
 	}
+	if p.source != nil {
+		return p.pull(data)
+	}
 	p.rwCond.L.Lock()
-	var outSamples *C.float
-	available := C.paulstretch_read(p.ps, &outSamples)
-	for !available {
+	available := p.available()
+	if !available && !p.underrun {
+		atomic.AddInt64(&p.stats.readStalls, 1)
+	}
+	for {
+		for !available {
+			if p.closed {
+				p.rwCond.L.Unlock()
+				return 0, p.endErr()
+			}
+			if p.underrun {
+				return p.silence(data), nil
+			}
+			if !p.readDeadline.IsZero() && !time.Now().Before(p.readDeadline) {
+				p.rwCond.L.Unlock()
+				return 0, ErrDeadlineExceeded
+			}
+			p.grantPermit()
+			p.rwCond.Wait()
+			available = p.available()
+		}
+		if n := p.emit(data); n > 0 {
+			return n, nil
+		}
+		// the window was entirely held back for the fade out of WithFade, or discarded by Prime: wait for the next one
+		p.rwCond.L.Lock()
+		available = p.available()
+	}
+}
+
+// ReadAllAfterClose reads all the remaining stretched audio, once Paulstretch is closed, and returns it,
+// as a convenience for tests and small jobs that write all their input, then call Flush and Close.
+//
+// The returned slice is allocated at once for the stretched audio of the written samples, as estimated
+// by EstimateOutputSamples, rather than grown as it is read. ReadAllAfterClose returns ErrNotClosed if
+// Paulstretch is not closed yet: use DrainTo to read the stretched audio while it is still being written.
+// Like Read, it returns the error set by CloseWithError instead of nil, along with the stretched audio read.
+func (p *Paulstretch) ReadAllAfterClose() ([]byte, error) {
+	if !p.initialized() {
+		return nil, ErrClosed
+	}
+	if !p.isClosed() {
+		return nil, ErrNotClosed
+	}
+	var out bytes.Buffer
+	if estimate := p.EstimateOutputSamples(atomic.LoadInt64(&p.stats.bytesWritten)/4) * 4; estimate > 0 {
+		// the estimate is exact to within a window: add a window so that the buffer is not grown
+		size := estimate - atomic.LoadInt64(&p.stats.bytesRead) + int64(p.windowSize*p.channels*4)
+		if size > maxStretchGrow {
+			size = maxStretchGrow
+		}
+		out.Grow(int(size))
+	}
+	_, err := io.Copy(&out, p)
+	return out.Bytes(), err
+}
+
+// silence fills data with silence for WithUnderrunSilence, and returns its length. It must be called
+// with the lock held, and releases it.
+func (p *Paulstretch) silence(data []byte) int {
+	p.grantPermit()
+	p.rwCond.L.Unlock()
+	if p.outRange != nil {
+		// silence is the center of the range
+		center := math.Float32bits(p.outRange.fromUnit(0))
+		for i := 0; i+4 <= len(data); i += 4 {
+			p.byteOrder.PutUint32(data[i:], center)
+		}
+	} else {
+		for i := range data {
+			data[i] = 0
+		}
+	}
+	atomic.AddInt64(&p.stats.underruns, 1)
+	return len(data)
+}
+
+// DrainTo writes all the remaining stretched audio to w, and returns the number of bytes written once
+// Paulstretch is closed and all stretched audio was read, as a single call to finalize an output.
+//
+// DrainTo is typically called after Close, or concurrently with a final Flush and Close: like Read,
+// it waits for the stretched audio of the windows being flushed, and only returns once Close is called.
+// The returned error is nil once all stretched audio was written, or the first error returned by w.
+func (p *Paulstretch) DrainTo(w io.Writer) (int64, error) {
+	return io.Copy(w, p)
+}
+
+// ReadFull reads exactly len(data) bytes of the stretched audio sample stream, blocking until data is filled,
+// rather than returning the stretched audio available as Read does, with the semantics of io.ReadFull.
+//
+// ReadFull returns EOF only if no bytes were read because all stretched audio was already read, and
+// io.ErrUnexpectedEOF if the stretched audio ended after some bytes were read but before data was filled.
+// The error set by CloseWithError is returned as is.
+func (p *Paulstretch) ReadFull(data []byte) (int, error) {
+	return io.ReadFull(p, data)
+}
+
+// TryRead is a non-blocking variant of Read: it reads bytes of the stretched audio sample stream
+// only if some are immediately available.
+//
+// TryRead returns the number of bytes read and true if stretched audio was available, or 0 and false
+// otherwise, for example if Paulstretch is waiting for more samples to be written, or if it is closed
+// and all stretched audio has already been read. This lets a real-time caller poll for stretched audio
+// (and output silence instead when none is available) rather than wait for it.
+//
+// With WithMaxOutputSamples, TryRead returns 0 and false once the limit of stretched samples was read.
+func (p *Paulstretch) TryRead(data []byte) (int, bool) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	data, limited := p.limit(data)
+	if limited {
+		return 0, false
+	}
+	n, ok, closed := p.tryRead(data)
+	if !ok && closed {
+		// all stretched audio was read
+		p.endErr()
+	}
+	p.observe(data[:n])
+	return n, ok
+}
+
+// tryRead implements TryRead, and also returns whether Paulstretch is closed when no stretched audio is available.
+//
+// If data is empty but stretched audio is available, it is kept in readBuf for the next read.
+func (p *Paulstretch) tryRead(data []byte) (n int, ok bool, closed bool) {
+	if !p.enter() {
+		return 0, false, true
+	}
+	defer p.leave()
+	if p.readOff < len(p.readBuf) {
+		n := copy(data, p.readBuf[p.readOff:])
+		p.advance(n)
+		return n, true, false
+	}
+	p.rwCond.L.Lock()
+	for {
+		if !p.available() {
+			closed := p.closed
+			p.grantPermit()
+			p.rwCond.L.Unlock()
+			return 0, false, closed
+		}
+		if n := p.emit(data); n > 0 || len(p.readBuf) > 0 {
+			return n, true, false
+		}
+		// the window was entirely held back for the fade out of WithFade
+		p.rwCond.L.Lock()
+	}
+}
+
+// limit returns data shortened to the number of bytes that can still be read with WithMaxOutputSamples,
+// and whether the limit was already reached.
+func (p *Paulstretch) limit(data []byte) ([]byte, bool) {
+	if p.maxOutput == 0 {
+		return data, false
+	}
+	remaining := p.maxOutput - atomic.LoadInt64(&p.stats.bytesRead)
+	if remaining <= 0 {
+		return data, true
+	}
+	if int64(len(data)) > remaining {
+		data = data[:remaining]
+	}
+	return data, false
+}
+
+// limitErr waits until Paulstretch either is closed with all stretched audio read, and returns the error returned
+// by Read at the end of the stream, or has more stretched audio than the limit of WithMaxOutputSamples,
+// and returns ErrOutputLimitExceeded, keeping the stretched audio in readBuf.
+func (p *Paulstretch) limitErr() error {
+	for p.readOff == len(p.readBuf) {
+		p.rwCond.L.Lock()
+		if p.available() {
+			p.emit(nil)
+			continue
+		}
 		if p.closed {
 			p.rwCond.L.Unlock()
-			return 0, io.EOF
+			return p.endErr()
 		}
-		select {
-		// add a write permit if none is currently pending
-		case p.writePermit <- struct{}{}:
-		default:
+		if p.source != nil {
+			p.rwCond.L.Unlock()
+			if err := p.pullWindow(); err != nil {
+				return err
+			}
+			continue
+		}
+		if !p.readDeadline.IsZero() && !time.Now().Before(p.readDeadline) {
+			p.rwCond.L.Unlock()
+			return ErrDeadlineExceeded
 		}
+		p.grantPermit()
 		p.rwCond.Wait()
-		available = C.paulstretch_read(p.ps, &outSamples)
+		p.rwCond.L.Unlock()
 	}
-	p.rwCond.L.Unlock()
-	sh := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(outSamples)),
-		Len:  len(p.readBuf),
-		Cap:  len(p.readBuf),
+	return ErrOutputLimitExceeded
+}
+
+// available returns whether a window of stretched samples is available, reading it from the C instances.
+// It must be called with the lock held.
+func (p *Paulstretch) available() bool {
+	if p.released {
+		return false
+	}
+	for {
+		if p.ring != nil {
+			p.fill()
+			if len(p.ring.queue) > 0 {
+				return true
+			}
+		} else if p.preloaded {
+			p.preloaded = false
+			return true
+		} else if p.read(p.outSamples) {
+			return true
+		}
+		if !p.frozen || p.closed {
+			break
+		}
+		// sustain the frozen window
+		for c, ps := range p.ps {
+			ps.write(p.last[c])
+		}
 	}
-	out := *(*[]byte)(unsafe.Pointer(&sh))
-	n := copy(data, out)
-	if n < len(p.readBuf) {
-		copy(p.readBuf[n:], out[n:])
-		p.readOff = n
+	if p.closed && p.finisher != nil && p.finisher.pending() {
+		// the end of the stream is now known: the frames held back by the limiter and for the fade out are available
+		p.ending = true
+		return true
 	}
-	return n, nil
+	return false
+}
+
+// emit copies the window of stretched samples just made available to data, keeping what does not fit
+// in readBuf, and returns the number of bytes copied. It must be called with the lock held, and releases it.
+func (p *Paulstretch) emit(data []byte) int {
+	if p.ending {
+		p.ending = false
+		p.readBuf = p.encode(p.finisher.finish(), p.readBuf[:0])
+		atomic.AddInt64(&p.stats.produced, int64(len(p.readBuf)/4))
+		p.rwCond.L.Unlock()
+	} else if p.ring != nil {
+		p.ring.free = append(p.ring.free, p.readBuf[:0])
+		p.readBuf = p.ring.pop()
+		if p.fill() {
+			// the C instances have no more stretched samples
+			p.grantPermit()
+		}
+		p.rwCond.L.Unlock()
+	} else {
+		mix := p.dryMix
+		p.dryMix = 0
+		p.rwCond.L.Unlock()
+		if p.direct {
+			// copy straight from the C instance, and only keep what does not fit in data
+			out := unsafe.Slice((*byte)(unsafe.Pointer(&p.outSamples[0][0])), p.windowSize*4)
+			out = out[p.discard(len(out)/4)*4:]
+			atomic.AddInt64(&p.stats.produced, int64(len(out)/4))
+			n := copy(data, out)
+			p.readBuf = p.readBuf[:len(out)]
+			copy(p.readBuf[n:], out[n:])
+			p.readOff = 0
+			p.advance(n)
+			p.preload()
+			return n
+		}
+		frames := p.process(mix, true)
+		atomic.AddInt64(&p.stats.produced, int64(len(frames)))
+		if len(frames)*4 <= len(data) {
+			// encode straight into data, rather than into readBuf then copying
+			n := len(p.encode(frames, data[:0]))
+			p.readBuf = p.readBuf[:0]
+			p.readOff = 0
+			p.advance(n)
+			p.preload()
+			return n
+		}
+		p.readBuf = p.encode(frames, p.readBuf[:0])
+		p.preload()
+	}
+	n := copy(data, p.readBuf)
+	p.readOff = 0
+	p.advance(n)
+	return n
+}
+
+// grantPermit lets the next window be written, once the C instances have no more stretched samples, unless
+// a permit was already granted for a window not yet written, or Paulstretch is closed. It must be called
+// with the lock held.
+//
+// A window must only be written to the C instances once they have no more stretched samples, which would
+// otherwise be overwritten: granting at most one permit at a time, until its window is written, ensures that
+// a second window is not written after a single check that the C instances have no more stretched samples.
+func (p *Paulstretch) grantPermit() {
+	if p.permitted || p.closed {
+		return
+	}
+	select {
+	case p.writePermit <- struct{}{}:
+		p.permitted = true
+	default:
+	}
+}
+
+// preload reads the next window of stretched samples from the C instances into outSamples, once the last one
+// was emitted, for the next call of available, and grants a write permit if there is none: the next window
+// can then be written while the stretched audio kept in readBuf is read, however small the reads, rather
+// than once it is all read.
+func (p *Paulstretch) preload() {
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.released || p.preloaded {
+		return
+	}
+	if p.read(p.outSamples) {
+		p.preloaded = true
+	} else if !p.frozen {
+		p.grantPermit()
+	}
+}
+
+// advance marks n more bytes of readBuf as read.
+func (p *Paulstretch) advance(n int) {
+	p.readOff += n
+	atomic.AddInt64(&p.stats.bytesRead, int64(n))
+	atomic.StoreInt64(&p.stats.pending, int64(len(p.readBuf)-p.readOff))
+}
+
+// read reads a window of stretched samples of each channel from the C instances into out,
+// and returns whether they were available.
+func (p *Paulstretch) read(out [][]float32) bool {
+	for c, ps := range p.ps {
+		// all channels are stretched in lockstep, so they are all available or all not available
+		samples, ok := ps.read()
+		if !ok {
+			return false
+		}
+		out[c] = samples
+	}
+	return true
+}
+
+// output processes the window of stretched samples of each channel with process, and returns them encoded
+// into buf, which is grown if needed.
+func (p *Paulstretch) output(mix float32, buf []byte) []byte {
+	return p.encode(p.process(mix, true), buf)
+}
+
+// encode returns frames encoded into buf, which is grown if needed.
+func (p *Paulstretch) encode(frames []float32, buf []byte) []byte {
+	if cap(buf) < len(frames)*4 {
+		buf = make([]byte, len(frames)*4)
+	}
+	buf = buf[:len(frames)*4]
+	for i, v := range frames {
+		if p.outRange != nil {
+			v = p.outRange.fromUnit(v)
+		}
+		p.byteOrder.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// process interleaves the window of stretched samples of each channel into outFrames, processes them,
+// and returns the processed frames, valid until the next call.
+//
+// mix is the proportion of the unstretched window of a detected onset to mix into the output, if any.
+// hold is whether the frames for the fade out of WithFade are held back until the end of the stream.
+func (p *Paulstretch) process(mix float32, hold bool) []float32 {
+	for c, channel := range p.outSamples {
+		for i, v := range channel {
+			p.outFrames[i*p.channels+c] = v
+		}
+	}
+	if mix > 0 {
+		for i, v := range p.dry {
+			p.outFrames[i] = (1-mix)*p.outFrames[i] + mix*v
+		}
+	}
+	frames := p.outFrames
+	if p.pitch != nil {
+		p.pitched = p.pitch.process(frames, p.pitched[:0])
+		frames = p.pitched
+	}
+	if p.gain != 1 {
+		for i, v := range frames {
+			frames[i] = float32(math.Max(-1, math.Min(1, float64(v*p.gain))))
+		}
+	}
+	frames = frames[p.discard(len(frames)/p.channels)*p.channels:]
+	if p.finisher != nil {
+		frames = p.finisher.process(frames, hold)
+	}
+	return frames
 }
 
 // ReadSamples is a utility function that eventually calls Read with this sample array.
@@ -195,19 +1218,165 @@ func (p *Paulstretch) Read(data []byte) (int, error) {
 // ReadSamples returns the number of samples read from Paulstretch and any underlying error
 // encountered during Read.
 func (p *Paulstretch) ReadSamples(samples []float32) (int, error) {
-	sh := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(&samples[0])),
-		Len:  len(samples) * 4,
-		Cap:  len(samples) * 4,
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	return p.readSamples(samples)
+}
+
+// readSamples implements ReadSamples, with readMu held.
+func (p *Paulstretch) readSamples(samples []float32) (int, error) {
+	if len(samples) == 0 {
+		return 0, nil
+	}
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	n, err := p.readAvailable(b)
+	runtime.KeepAlive(samples)
+	if p.byteOrder != nativeOrder {
+		swap32(b[:n])
 	}
-	b := *(*[]byte)(unsafe.Pointer(&sh))
-	n, err := p.Read(b)
 	return n / 4, err
 }
 
-// OptimalBufferSize returns the optimal size, in samples, of the buffers to be passed to WriteSamples and Readsamples.
+// ReadSamplesInto reads stretched samples into samples like ReadSamples, for tight real-time loops that
+// reuse a slice of OptimalBufferSize samples: each window of stretched samples is then processed straight
+// into samples, without allocating and without copying through an internal buffer. For smaller slices,
+// it falls back to copying the stretched samples through an internal buffer, keeping those that do not fit
+// for the next call. ReadSamples takes the same fast path: ReadSamplesInto makes the size requirement explicit.
+func (p *Paulstretch) ReadSamplesInto(samples []float32) (int, error) {
+	return p.ReadSamples(samples)
+}
+
+// OptimalBufferSize returns the optimal size, in samples, of the buffers to be passed to ReadSamples (and Read,
+// in bytes, times 4). For multichannel audio, this is the size of a window of frames, times the number of channels.
 //
 // Paulstretch internally uses buffers of this size to process data, and using buffers of this size helps avoid some copying.
+// It is the optimal size for reading: see OptimalWriteBufferSize for writing.
 func (p *Paulstretch) OptimalBufferSize() int {
-	return len(p.readBuf) / 4
+	return p.windowSize * p.channels
+}
+
+// OptimalWriteBufferSize returns the optimal size, in samples, of the buffers to be passed to WriteSamples (and Write,
+// in bytes, times 4). For multichannel audio, this is the size of a window of frames, times the number of channels.
+//
+// Writing buffers of this size (or multiples of it) submits each window as is for stretching, without copying it to an
+// internal buffer first, and without allocating.
+// With WithResample, the written samples are always copied, and this is the number of samples resampled to about a window.
+// With WithDownmixToMono, the written samples are also always copied, and this counts the samples of all the written channels.
+func (p *Paulstretch) OptimalWriteBufferSize() int {
+	channels := p.channels
+	if p.downmix != 0 {
+		channels = p.downmix
+	}
+	if p.inResampler != nil {
+		return int(math.Round(float64(p.windowSize)*p.inResampler.step)) * channels
+	}
+	return p.windowSize * channels
+}
+
+// EstimateOutputSamples returns the number of stretched samples that Paulstretch produces from inputSamples
+// samples of input (counting the samples of all channels), once they are written, flushed and read.
+//
+// Each window of input, including the last window padded by Flush, produces windows of stretched audio of
+// the same size in proportion to the stretch factor, so that the output is a whole number of windows.
+// The result is an estimate, exact to within one window of stretched audio: for example, to write
+// the length of a stream in a header before stretching it, the stretched audio should be truncated
+// or padded to the estimated length.
+//
+// With WithLimiter, the estimate includes the silence of the look-ahead of the limiter, and with WithSeamlessLoop,
+// it excludes the crossfaded frames.
+// EstimateOutputSamples returns -1 with WithStretchEnvelope or WithStretchChanges, since the stretch factor
+// is then only known as the input is written.
+func (p *Paulstretch) EstimateOutputSamples(inputSamples int64) int64 {
+	if !p.initialized() {
+		return 0
+	}
+	if p.envelope != nil {
+		return -1
+	}
+	if p.downmix != 0 {
+		inputSamples /= int64(p.downmix)
+	}
+	window := int64(p.windowSize * p.channels)
+	windows := (inputSamples + window - 1) / window
+	samples := int64(math.Round(float64(windows)*p.stretchFactor)) * window
+	if p.finisher != nil && p.finisher.limiter != nil {
+		samples += int64(limiterLookahead * p.channels)
+	}
+	if p.finisher != nil && p.finisher.loop > 0 {
+		// the crossfade is at most half the stretched audio
+		if loop := int64(p.finisher.loop * p.channels); loop < samples/2 {
+			samples -= loop
+		} else {
+			samples -= samples / (2 * int64(p.channels)) * int64(p.channels)
+		}
+	}
+	return samples
+}
+
+// LoopLength returns the length of the loop of WithSeamlessLoop, in frames (samples per channel): the number
+// of frames of stretched audio, after Paulstretch was closed and the stretched audio was made available to Read.
+// The caller can set the loop region of the stretched audio to these frames, starting from the first frame.
+//
+// ok is false until the length is known, or without WithSeamlessLoop.
+func (p *Paulstretch) LoopLength() (frames int64, ok bool) {
+	if !p.initialized() || p.finisher == nil {
+		return 0, false
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.finisher.looped < 0 {
+		return 0, false
+	}
+	return p.finisher.looped, true
+}
+
+// InputPositionForOutput returns the position in the input of the stretched audio at an output position, both
+// in frames (samples per channel) since the start of the streams, for example to synchronize video with the
+// stretched audio, or to show the position in the input while scrubbing.
+//
+// The output position is mapped back through the latency (see Latency) and the stretch factor, which can vary with
+// WithStretchEnvelope or QueueStretchChange: the mapping of the windows of input written so far is tracked to invert
+// it, and output positions past the stretched audio of the windows written so far are mapped to the end of these
+// windows. Positions in the latency, before the stretched audio of the first window, are mapped to 0. With WithResample,
+// the position is in the input before resampling. The result has the resolution of the stretching: a sample
+// of input is smeared over a window of stretched audio.
+func (p *Paulstretch) InputPositionForOutput(outputSample int64) int64 {
+	if !p.initialized() {
+		return 0
+	}
+	out := float64(outputSample - int64(p.Latency()))
+	var in float64
+	if p.envelope != nil {
+		in = p.envelope.inputPosition(out/float64(p.windowSize), p.windowSize)
+	} else {
+		in = out / p.stretchFactor
+	}
+	if p.inResampler != nil {
+		in *= p.inResampler.step
+	}
+	return int64(math.Max(0, math.Round(in)))
+}
+
+// Latency returns the algorithmic latency of Paulstretch, in frames (samples per channel) of stretched audio:
+// the delay between the position of an input sample in the stretched audio, that is its position in the input
+// times the stretch factor, and the center of the stretched audio it produces.
+//
+// A sample of input is smeared over a window of stretched audio, so its stretched audio is centered around
+// the window it is stretched in. The latency is that of libpaulstretch, or of the pure Go implementation
+// when cgo is disabled (and 0 for a stretch factor of 1, which passes the audio through), converted to the rate
+// of the stretched audio with WithPitchShift, plus the current look-ahead of WithLimiter (see SetLookahead). WithDCBlock, WithResample
+// and WithPitchShift only buffer a couple of frames, and add no latency to the timing of the stretched audio.
+// The fade out of WithFade holds back the end of the stretched audio, but does not change its timing either.
+func (p *Paulstretch) Latency() int {
+	if !p.initialized() {
+		return 0
+	}
+	latency := float64(p.ps[0].latency())
+	if p.pitch != nil {
+		latency /= p.pitch.step
+	}
+	if p.finisher != nil && p.finisher.limiter != nil {
+		latency += float64(p.finisher.limiter.getLookahead())
+	}
+	return int(math.Round(latency))
 }
@@ -0,0 +1,1506 @@
+package paulstretch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+const testWindowSize = 128
+
+// testSamples returns n samples of a test signal.
+func testSamples(n int) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(i%100)/100 - 0.5
+	}
+	return samples
+}
+
+func TestOutputBuffers(t *testing.T) {
+	for _, tc := range []struct {
+		buffers int
+		blocks  bool
+	}{
+		{0, true},
+		{4, false},
+	} {
+		p := NewPaulstretchWithOptions(1, testWindowSize, WithOutputBuffers(tc.buffers))
+		p.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := p.WriteSamples(testSamples(4 * testWindowSize))
+		if tc.blocks {
+			if err != ErrDeadlineExceeded {
+				t.Errorf("buffers %d: WriteSamples without Read: got error %v, want %v", tc.buffers, err, ErrDeadlineExceeded)
+			}
+		} else if err != nil || n != 4*testWindowSize {
+			t.Errorf("buffers %d: WriteSamples without Read: got (%d, %v), want (%d, nil)", tc.buffers, n, err, 4*testWindowSize)
+		}
+		p.Close()
+	}
+}
+
+func TestReleaseBuffersDuringWrite(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChannels(2)}} {
+		p := NewPaulstretchWithOptions(2, testWindowSize, opts...)
+		samples := testSamples(10*testWindowSize + 1)
+		done := make(chan error)
+		go func() {
+			// blocks since nothing reads the stretched audio
+			_, err := p.WriteSamples(samples)
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		p.ReleaseBuffers()
+		if err := <-done; err != ErrClosed {
+			t.Errorf("WriteSamples during ReleaseBuffers: got error %v, want %v", err, ErrClosed)
+		}
+		if n, err := p.WriteSamples(samples); n != 0 || err != ErrClosed {
+			t.Errorf("WriteSamples after ReleaseBuffers: got (%d, %v), want (0, %v)", n, err, ErrClosed)
+		}
+		if err := p.Flush(); err != ErrClosed {
+			t.Errorf("Flush after ReleaseBuffers: got error %v, want %v", err, ErrClosed)
+		}
+		if n, err := p.Read(make([]byte, 16)); n != 0 || err != io.EOF {
+			t.Errorf("Read after ReleaseBuffers: got (%d, %v), want (0, %v)", n, err, io.EOF)
+		}
+	}
+}
+
+// stretchAll writes samples to p with write, closes it, and returns all the stretched samples read from it with read.
+func stretchAll(t *testing.T, p *Paulstretch, samples []float32, write func([]float32) error, read func([]float32) (int, error)) []float32 {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		err := write(samples)
+		if err == nil {
+			err = p.Flush()
+		}
+		p.Close()
+		done <- err
+	}()
+	var out []float32
+	buf := make([]float32, 100)
+	for {
+		n, err := read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return out
+}
+
+// TestReadWrite covers the conversions between bytes and samples of Write, WriteSamples, Read and ReadSamples.
+// Run it with -gcflags=all=-d=checkptr to check their unsafe pointer conversions.
+func TestReadWrite(t *testing.T) {
+	samples := testSamples(10*testWindowSize + 3)
+	writes := map[string]func(p *Paulstretch) func([]float32) error{
+		"Write": func(p *Paulstretch) func([]float32) error {
+			return func(samples []float32) error {
+				b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+				// write in chunks not aligned on windows
+				for len(b) > 0 {
+					c := 4 * 37
+					if c > len(b) {
+						c = len(b)
+					}
+					n, err := p.Write(b[:c])
+					if err != nil {
+						return err
+					}
+					b = b[n:]
+				}
+				return nil
+			}
+		},
+		"WriteSamples": func(p *Paulstretch) func([]float32) error {
+			return func(samples []float32) error {
+				n, err := p.WriteSamples(samples)
+				if err == nil && n != len(samples) {
+					t.Errorf("WriteSamples: got %d samples written, want %d", n, len(samples))
+				}
+				return err
+			}
+		},
+	}
+	reads := map[string]func(p *Paulstretch) func([]float32) (int, error){
+		"Read": func(p *Paulstretch) func([]float32) (int, error) {
+			return func(samples []float32) (int, error) {
+				b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+				n, err := io.ReadFull(p, b)
+				if err == io.ErrUnexpectedEOF {
+					err = io.EOF
+				}
+				return n / 4, err
+			}
+		},
+		"ReadSamples": func(p *Paulstretch) func([]float32) (int, error) {
+			return p.ReadSamples
+		},
+	}
+	for _, opts := range [][]Option{nil, {WithChannels(2)}} {
+		for writeName, write := range writes {
+			for readName, read := range reads {
+				p := NewPaulstretchWithOptions(2, testWindowSize, opts...)
+				out := stretchAll(t, p, samples, write(p), read(p))
+				if len(out) < len(samples) {
+					t.Errorf("%s/%s: got %d stretched samples, want at least %d", writeName, readName, len(out), len(samples))
+				}
+				for i, v := range out {
+					if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+						t.Errorf("%s/%s: got non-finite stretched sample %v at %d", writeName, readName, v, i)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEmptySamples(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	defer p.Close()
+	for name, samples := range map[string][]float32{"nil": nil, "empty": {}} {
+		if n, err := p.WriteSamples(samples); n != 0 || err != nil {
+			t.Errorf("WriteSamples(%s): got (%d, %v), want (0, nil)", name, n, err)
+		}
+		if n, err := p.ReadSamples(samples); n != 0 || err != nil {
+			t.Errorf("ReadSamples(%s): got (%d, %v), want (0, nil)", name, n, err)
+		}
+	}
+}
+
+func TestEmptyRead(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	if n, err := p.Read(nil); n != 0 || err != nil {
+		t.Errorf("empty Read before any Write: got (%d, %v), want (0, nil)", n, err)
+	}
+
+	go func() {
+		// stopped with ErrClosed by Close below
+		p.WriteSamples(testSamples(100 * testWindowSize))
+	}()
+	// read part of the stretched audio, so that some stays in the internal buffer
+	if _, err := io.ReadFull(p, make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.Read(nil); n != 0 || err != nil {
+		t.Errorf("empty Read after partial output: got (%d, %v), want (0, nil)", n, err)
+	}
+	p.Close()
+	// after Close, empty reads return EOF only once the internal buffer is drained
+	if n, err := p.Read(nil); n != 0 || err != nil {
+		t.Errorf("empty Read after Close with pending output: got (%d, %v), want (0, nil)", n, err)
+	}
+	if _, err := io.ReadAll(p); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.Read(nil); n != 0 || err != io.EOF {
+		t.Errorf("empty Read after Close and drain: got (%d, %v), want (0, %v)", n, err, io.EOF)
+	}
+}
+
+func TestNewPaulstretchChecked(t *testing.T) {
+	for _, tc := range []struct {
+		stretchFactor float64
+		windowSize    int
+		err           error
+	}{
+		{1, testWindowSize, nil},
+		{0.5, testWindowSize, ErrInvalidStretchFactor},
+		{math.NaN(), testWindowSize, ErrInvalidStretchFactor},
+		{math.Inf(1), testWindowSize, ErrInvalidStretchFactor},
+		{2, testWindowSize - 1, ErrInvalidWindowSize},
+	} {
+		p, err := NewPaulstretchChecked(tc.stretchFactor, tc.windowSize)
+		if !errors.Is(err, tc.err) || (err == nil) != (p != nil) {
+			t.Errorf("NewPaulstretchChecked(%v, %d): got (%v, %v), want error %v", tc.stretchFactor, tc.windowSize, p, err, tc.err)
+		}
+		if p != nil {
+			p.Close()
+			if _, err := p.Write(make([]byte, 4)); !errors.Is(err, ErrClosed) {
+				t.Errorf("Write after Close: got error %v, want %v", err, ErrClosed)
+			}
+		}
+	}
+}
+
+func TestWindowSize(t *testing.T) {
+	for _, tc := range []struct {
+		windowSize int
+		want       int // window size used by NewPaulstretch
+		err        error
+	}{
+		{0, minWindowSize, ErrInvalidWindowSize},
+		{1, minWindowSize, ErrInvalidWindowSize},
+		{127, minWindowSize, ErrInvalidWindowSize},
+		{128, 128, nil},
+		{11025, 11025, nil},
+	} {
+		if _, err := NewPaulstretchChecked(2, tc.windowSize); !errors.Is(err, tc.err) {
+			t.Errorf("NewPaulstretchChecked(2, %d): got error %v, want %v", tc.windowSize, err, tc.err)
+		}
+		p := NewPaulstretch(2, tc.windowSize)
+		if got := p.Parameters().WindowSize; got != tc.want {
+			t.Errorf("NewPaulstretch(2, %d): got window size %d, want %d", tc.windowSize, got, tc.want)
+		}
+		samples := testSamples(3*tc.want + 5)
+		out := stretchAll(t, p, samples, func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+		if len(out) < 2*len(samples) {
+			t.Errorf("NewPaulstretch(2, %d): got %d stretched samples, want at least %d", tc.windowSize, len(out), 2*len(samples))
+		}
+		for i, v := range out {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				t.Fatalf("NewPaulstretch(2, %d): stretched sample %d is %v", tc.windowSize, i, v)
+			}
+		}
+	}
+}
+
+func TestWriteFromAll(t *testing.T) {
+	samples := testSamples(5 * testWindowSize)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	p := NewPaulstretch(1, testWindowSize)
+	go io.Copy(io.Discard, p)
+	// streams of lengths that are not multiples of the window size
+	n, err := p.WriteFromAll(bytes.NewReader(b[:100*4]), bytes.NewReader(b[100*4:300*4]), bytes.NewReader(b[300*4:]))
+	if n != int64(len(b)) || err != nil {
+		t.Fatalf("WriteFromAll: got (%d, %v), want (%d, nil)", n, err, len(b))
+	}
+	// the tails of the streams were carried over: only full windows were stretched, without any padding
+	if windows := p.Stats().WindowsProcessed; windows != 5 {
+		t.Errorf("WriteFromAll: got %d windows processed, want 5", windows)
+	}
+	p.Close()
+}
+
+func TestStretchEnvelope(t *testing.T) {
+	var positions []int64
+	envelope := func(inputSample int64) float64 {
+		positions = append(positions, inputSample)
+		// ramp from 1 to 4, with a value below 1 that must be clamped
+		return []float64{0, 2.5, 4, 2.5}[inputSample/testWindowSize]
+	}
+	for _, opts := range [][]Option{{WithStretchEnvelope(envelope)}, {WithStretchEnvelope(envelope), WithChannels(2)}} {
+		positions = nil
+		p := NewPaulstretchWithOptions(100, testWindowSize, opts...)
+		samples := testSamples(4 * testWindowSize * p.channels)
+		out := stretchAll(t, p, samples, func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+		for i, pos := range positions {
+			if pos != int64(i*testWindowSize) {
+				t.Errorf("envelope called with positions %v, want multiples of the window size", positions)
+				break
+			}
+		}
+		// 1 + 2.5 + 4 + 2.5 = 10 windows, instead of 400 windows with the stretch factor
+		if windows := len(out) / (testWindowSize * p.channels); windows < 8 || windows > 12 {
+			t.Errorf("got %d stretched windows, want about 10", windows)
+		}
+		if processed := p.Stats().WindowsProcessed; processed != 4 {
+			t.Errorf("got %d windows processed, want 4", processed)
+		}
+	}
+}
+
+func TestQueueStretchChange(t *testing.T) {
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithStretchChanges())
+	for c := range p.ps {
+		p.ps[c].destroy()
+		p.ps[c] = &identityEngine{}
+	}
+	// 2 windows at 1, then 2 windows at 3, then 2 windows at 2: the last change replaces the change to 5
+	p.QueueStretchChange(2*testWindowSize-10, 3)
+	p.QueueStretchChange(4*testWindowSize, 5)
+	p.QueueStretchChange(0, 2)
+	out := stretchAll(t, p, testSamples(6*testWindowSize), func(s []float32) error {
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	if windows, want := len(out)/testWindowSize, 2+2*3+2*2; windows != want {
+		t.Errorf("got %d stretched windows, want %d", windows, want)
+	}
+	for _, c := range []struct{ out, in int64 }{
+		{0, 0},
+		{testWindowSize, testWindowSize},
+		{5 * testWindowSize, 3 * testWindowSize},
+		{9 * testWindowSize, 9 * testWindowSize / 2},
+		{100 * testWindowSize, 6 * testWindowSize},
+	} {
+		if in := p.InputPositionForOutput(c.out); in != c.in {
+			t.Errorf("InputPositionForOutput(%d): got %d, want %d", c.out, in, c.in)
+		}
+	}
+
+	if err := NewPaulstretch(2, testWindowSize).QueueStretchChange(0, 3); err != ErrFixedStretchFactor {
+		t.Errorf("QueueStretchChange with a fixed stretch factor: got error %v, want %v", err, ErrFixedStretchFactor)
+	}
+}
+
+func TestInputPositionForOutput(t *testing.T) {
+	p := NewPaulstretch(4, testWindowSize)
+	defer p.Close()
+	latency := int64(p.Latency())
+	for _, c := range []struct{ out, in int64 }{
+		{0, 0},
+		{latency, 0},
+		{latency + 4000, 1000},
+		{latency + 4002, 1001},
+	} {
+		if in := p.InputPositionForOutput(c.out); in != c.in {
+			t.Errorf("InputPositionForOutput(%d): got %d, want %d", c.out, in, c.in)
+		}
+	}
+}
+
+func TestTotalOutputSamples(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOutputBuffers(3)}, {WithChannels(2), WithFade(100, 100)}} {
+		p := NewPaulstretchWithOptions(3, testWindowSize, opts...)
+		samples := testSamples(5*testWindowSize + 9)
+		// reads shorter than a window keep the rest of the window for the next Read
+		out := stretchAll(t, p, samples, func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, func(buf []float32) (int, error) {
+			return p.ReadSamples(buf[:7])
+		})
+		total, want := p.TotalOutputSamples(), p.EstimateOutputSamples(int64(len(samples)))
+		if total != int64(len(out)) || total < want-int64(p.OptimalBufferSize()) || total > want+int64(p.OptimalBufferSize()) {
+			t.Errorf("got %d total output samples, %d read, want %d to within a window", total, len(out), want)
+		}
+	}
+}
+
+func TestDrainTo(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	samples := testSamples(3*testWindowSize + 5)
+	go func() {
+		p.WriteSamples(samples)
+		// final Flush, concurrent with DrainTo
+		p.Flush()
+		p.Close()
+	}()
+	var out bytes.Buffer
+	n, err := p.DrainTo(&out)
+	if err != nil || n != int64(out.Len()) {
+		t.Fatalf("DrainTo: got (%d, %v), want (%d, nil)", n, err, out.Len())
+	}
+	// the flushed end of the stream was drained too
+	if n < int64(len(samples)*4) {
+		t.Errorf("DrainTo: got %d bytes, want at least %d", n, len(samples)*4)
+	}
+	if n, err := p.Read(make([]byte, 4)); n != 0 || err != io.EOF {
+		t.Errorf("Read after DrainTo: got (%d, %v), want (0, %v)", n, err, io.EOF)
+	}
+}
+
+func TestParameters(t *testing.T) {
+	p := NewPaulstretchWithOptions(3, testWindowSize, WithChannels(2), WithByteOrder(binary.BigEndian))
+	defer p.Close()
+	want := Parameters{StretchFactor: 3, WindowSize: testWindowSize, Channels: 2, ByteOrder: binary.BigEndian}
+	if got := p.Parameters(); got != want {
+		t.Errorf("Parameters: got %+v, want %+v", got, want)
+	}
+}
+
+func TestEstimateOutputSamples(t *testing.T) {
+	for _, tc := range []struct {
+		stretchFactor float64
+		opts          []Option
+		samples       int
+	}{
+		{1, nil, 10 * testWindowSize},
+		{2.5, nil, 7*testWindowSize + 3},
+		{4, []Option{WithChannels(2)}, 6*testWindowSize + 1},
+	} {
+		p := NewPaulstretchWithOptions(tc.stretchFactor, testWindowSize, tc.opts...)
+		estimate := p.EstimateOutputSamples(int64(tc.samples))
+		out := stretchAll(t, p, testSamples(tc.samples), func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+		window := int64(testWindowSize * p.channels)
+		if d := estimate - int64(len(out)); d < -window || d > window {
+			t.Errorf("factor %v, %d samples: got estimate %d, want within a window of %d", tc.stretchFactor, tc.samples, estimate, len(out))
+		}
+	}
+	if n := NewPaulstretchWithOptions(1, testWindowSize, WithStretchEnvelope(func(int64) float64 { return 2 })).EstimateOutputSamples(100); n != -1 {
+		t.Errorf("with a stretch envelope: got estimate %d, want -1", n)
+	}
+}
+
+func TestGain(t *testing.T) {
+	samples := testSamples(4 * testWindowSize)
+	write := func(p *Paulstretch) func([]float32) error {
+		return func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}
+	}
+	p := NewPaulstretch(1, testWindowSize)
+	ref := stretchAll(t, p, samples, write(p), p.ReadSamples)
+	// +12 dB is about a gain of 4: the test signal peaks at 0.5, and must be clipped
+	p = NewPaulstretchWithOptions(1, testWindowSize, WithGain(12))
+	out := stretchAll(t, p, samples, write(p), p.ReadSamples)
+	peak := 0.0
+	for _, v := range out {
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if peak > 1 {
+		t.Errorf("WithGain(12): got peak %v, want at most 1", peak)
+	}
+	refPeak := 0.0
+	for _, v := range ref {
+		refPeak = math.Max(refPeak, math.Abs(float64(v)))
+	}
+	if refPeak > 0.25 && peak < 1 {
+		t.Errorf("WithGain(12): got peak %v from a peak of %v, want clipped to 1", peak, refPeak)
+	}
+}
+
+func TestResample(t *testing.T) {
+	for _, tc := range []struct {
+		inputRate, outputRate int
+		windows               int64
+	}{
+		{48000, 24000, 4},
+		{44100, 44100, 8},
+		{22050, 44100, 16},
+	} {
+		p := NewPaulstretchWithOptions(1, testWindowSize, WithResample(tc.inputRate, tc.outputRate), WithChannels(2))
+		samples := testSamples(8 * testWindowSize * 2)
+		stretchAll(t, p, samples, func(s []float32) error {
+			// write in chunks not aligned on frames
+			b := unsafe.Slice((*byte)(unsafe.Pointer(&s[0])), len(s)*4)
+			for len(b) > 0 {
+				c := 4*37 + 2
+				if c > len(b) {
+					c = len(b)
+				}
+				if _, err := p.Write(b[:c]); err != nil {
+					return err
+				}
+				b = b[c:]
+			}
+			return nil
+		}, p.ReadSamples)
+		// the resampler delays the audio by a couple of frames, flushed in an additional window
+		if windows := p.Stats().WindowsProcessed; windows < tc.windows || windows > tc.windows+1 {
+			t.Errorf("WithResample(%d, %d): got %d windows processed, want %d", tc.inputRate, tc.outputRate, windows, tc.windows)
+		}
+		if written := p.Stats().SamplesWritten; written != int64(len(samples)) {
+			t.Errorf("WithResample(%d, %d): got %d samples written, want %d", tc.inputRate, tc.outputRate, written, len(samples))
+		}
+	}
+}
+
+func TestDownmixToMono(t *testing.T) {
+	stereo := testSamples(3*testWindowSize*2 + 6)
+	mono := make([]float32, len(stereo)/2)
+	for i := range mono {
+		mono[i] = (stereo[2*i] + stereo[2*i+1]) / 2
+	}
+	ref := NewPaulstretch(1, testWindowSize)
+	want := stretchAll(t, ref, mono, func(s []float32) error {
+		_, err := ref.WriteSamples(s)
+		return err
+	}, ref.ReadSamples)
+
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithChannels(2), WithDownmixToMono())
+	got := stretchAll(t, p, stereo, func(s []float32) error {
+		// write in chunks not aligned on frames
+		for len(s) > 0 {
+			c := 37
+			if c > len(s) {
+				c = len(s)
+			}
+			if _, err := p.WriteSamples(s[:c]); err != nil {
+				return err
+			}
+			s = s[c:]
+		}
+		return nil
+	}, p.ReadSamples)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d downmixed stretched samples, want the %d stretched samples of the averaged channels", len(got), len(want))
+	}
+	if estimate := p.EstimateOutputSamples(int64(len(stereo))); estimate != int64(len(want)) {
+		t.Errorf("EstimateOutputSamples: got %d, want %d", estimate, len(want))
+	}
+}
+
+func TestOptimalWriteBufferSize(t *testing.T) {
+	for i, opts := range [][]Option{nil, {WithChannels(2)}, {WithByteOrder(binary.BigEndian)}} {
+		p := NewPaulstretchWithOptions(1, testWindowSize, opts...)
+		go io.Copy(io.Discard, p)
+		size := p.OptimalWriteBufferSize()
+		samples := testSamples(size)
+		for j := 0; j < 4; j++ {
+			if _, err := p.WriteSamples(samples); err != nil {
+				t.Fatal(err)
+			}
+			// no samples are left pending, so that the next window is submitted without copying it to writeBuf
+			if p.writeOff != 0 {
+				t.Errorf("options %d: writing %d samples leaves %d bytes pending", i, size, p.writeOff)
+			}
+		}
+		p.Close()
+	}
+}
+
+func TestStalls(t *testing.T) {
+	p := NewPaulstretch(1, testWindowSize)
+	done := make(chan error, 1)
+	go func() {
+		// blocks until the stretched audio of the first window is read
+		_, err := p.WriteSamples(testSamples(2 * testWindowSize))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if stalls := p.Stats().WriteStalls; stalls != 1 {
+		t.Errorf("got %d write stalls, want 1", stalls)
+	}
+	buf := make([]float32, testWindowSize)
+	for i := 0; i < 2; i++ {
+		if _, err := p.ReadSamples(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.Close()
+	}()
+	// blocks until Close, since all stretched audio was read
+	if _, err := p.ReadSamples(buf); err != io.EOF {
+		t.Errorf("ReadSamples: got error %v, want %v", err, io.EOF)
+	}
+	if stalls := p.Stats().ReadStalls; stalls < 1 {
+		t.Errorf("got %d read stalls, want at least 1", stalls)
+	}
+}
+
+// identityEngine is an engine that returns each written window as is, to check the windowing of Paulstretch.
+type identityEngine struct {
+	window []float32
+	ok     bool
+}
+
+func (e *identityEngine) write(samples []float32) {
+	e.window = append(e.window[:0], samples[:testWindowSize]...)
+	e.ok = true
+}
+
+func (e *identityEngine) read() ([]float32, bool) {
+	ok := e.ok
+	e.ok = false
+	return e.window, ok
+}
+
+func (e *identityEngine) latency() int { return 0 }
+
+func (e *identityEngine) destroy() {}
+
+// TestWriteChunks writes data in chunks of many sizes after many starting offsets, and checks that Write
+// accounts for all bytes, and that the windows submitted are exactly the written data.
+func TestWriteChunks(t *testing.T) {
+	samples := testSamples(20*testWindowSize + 17)
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	window := testWindowSize * 4
+	for _, offset := range []int{0, 1, 4, 37, window - 1, window, window + 3, 3*window + 5} {
+		for _, chunk := range []int{1, 3, 4, 7, window - 1, window, window + 1, 2*window + 9, len(data)} {
+			p := NewPaulstretch(1, testWindowSize)
+			p.ps[0].destroy()
+			p.ps[0] = &identityEngine{}
+			out := make(chan []byte)
+			go func() {
+				b, _ := io.ReadAll(p)
+				out <- b
+			}()
+			written := 0
+			n, err := p.Write(data[:offset])
+			written += n
+			for b := data[offset:]; err == nil && len(b) > 0; {
+				c := chunk
+				if c > len(b) {
+					c = len(b)
+				}
+				n, err = p.Write(b[:c])
+				written += n
+				b = b[n:]
+			}
+			if err == nil {
+				err = p.Flush()
+			}
+			p.Close()
+			got := <-out
+			if err != nil || written != len(data) {
+				t.Errorf("offset %d, chunk %d: got (%d, %v) written, want (%d, nil)", offset, chunk, written, err, len(data))
+				continue
+			}
+			// the output is the written data, padded to a window by Flush
+			padded := len(data) + window - 1
+			padded -= padded % window
+			want := append(append([]byte(nil), data...), make([]byte, padded-len(data))...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("offset %d, chunk %d: got %d bytes of output different from the %d written", offset, chunk, len(got), len(want))
+			}
+		}
+	}
+}
+
+// TestWriteWindowMultiples writes data of exact multiples of windows, and of a byte less or more, in a single Write,
+// submitting the windows straight from data.
+func TestWriteBytes(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChannels(2)}, {WithInputRange(-2, 2)}} {
+		samples := testSamples(3*testWindowSize*2 + 6)
+		stretch := func(write func(p *Paulstretch) error) []float32 {
+			p := NewPaulstretchWithOptions(1, testWindowSize, opts...)
+			for c := range p.ps {
+				p.ps[c].destroy()
+				p.ps[c] = &identityEngine{}
+			}
+			return stretchAll(t, p, samples, func([]float32) error { return write(p) }, p.ReadSamples)
+		}
+		want := stretch(func(p *Paulstretch) error {
+			_, err := p.WriteSamples(samples)
+			return err
+		})
+		got := stretch(func(p *Paulstretch) error {
+			b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+			// a stream torn at every byte, ending with an incomplete sample
+			b = append(append([]byte(nil), b...), 0x12, 0x34)
+			for i := range b {
+				if _, err := p.Write(b[i : i+1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d options: got %d stretched samples written byte by byte, different from the %d written as samples", len(opts), len(got), len(want))
+		}
+	}
+}
+
+func TestWriteWindowMultiples(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		window := testWindowSize * channels * 4
+		for _, size := range []int{window - 1, window, window + 1, 3*window - 1, 3 * window, 3*window + 1} {
+			samples := testSamples(size/4 + 1)
+			data := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)[:size]
+			p := NewPaulstretchWithOptions(1, testWindowSize, WithChannels(channels))
+			for c := range p.ps {
+				p.ps[c].destroy()
+				p.ps[c] = &identityEngine{}
+			}
+			out := make(chan []byte)
+			go func() {
+				b, _ := io.ReadAll(p)
+				out <- b
+			}()
+			n, err := p.Write(data)
+			if err == nil {
+				// an empty Write right after the windows were submitted
+				_, err = p.Write(data[size:])
+			}
+			if err == nil {
+				_, err = p.WriteSamples(nil)
+			}
+			if err == nil {
+				err = p.Flush()
+			}
+			p.Close()
+			got := <-out
+			if err != nil || n != size {
+				t.Errorf("%d channels, %d bytes: got (%d, %v) written, want (%d, nil)", channels, size, n, err, size)
+				continue
+			}
+			// the bytes of an incomplete last sample are discarded
+			whole := size &^ 3
+			padded := whole + window - 1
+			padded -= padded % window
+			want := append(append([]byte(nil), data[:whole]...), make([]byte, padded-whole)...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d channels, %d bytes: got %d bytes of output different from the %d written", channels, size, len(got), len(want))
+			}
+		}
+	}
+}
+
+// TestSmallReads checks that the next window can be written as soon as the stretched audio of the last one is emitted,
+// rather than once it is all read by reads much smaller than a window, and that no window is lost.
+func TestSmallReads(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		p := NewPaulstretchWithOptions(1, testWindowSize, WithChannels(channels))
+		for c := range p.ps {
+			p.ps[c].destroy()
+			p.ps[c] = &identityEngine{}
+		}
+		samples := testSamples(20 * testWindowSize * channels)
+		window := samples[:testWindowSize*channels]
+		if _, err := p.WriteSamples(window); err != nil {
+			t.Fatal(err)
+		}
+		out := make([]float32, len(samples))
+		if n, err := p.ReadSamples(out[:1]); n != 1 || err != nil {
+			t.Fatalf("ReadSamples: got (%d, %v), want (1, nil)", n, err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := p.WriteSamples(samples[len(window):])
+			if err == nil {
+				err = p.CloseFlush()
+			}
+			done <- err
+		}()
+		// the second window is written while the stretched audio of the first one is not read yet
+		deadline := time.Now().Add(5 * time.Second)
+		for p.Stats().WindowsProcessed < 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d channels: the second window was not written before the first one was read", channels)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		for n := 1; n < len(out); {
+			m, err := p.ReadSamples(out[n : n+1])
+			n += m
+			if err != nil {
+				t.Fatalf("%d channels: ReadSamples: %v", channels, err)
+			}
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("%d channels: write: %v", channels, err)
+		}
+		for i, v := range out {
+			if v != samples[i] {
+				t.Fatalf("%d channels: got sample %d = %v, want %v", channels, i, v, samples[i])
+			}
+		}
+	}
+}
+
+func TestSanitizeInput(t *testing.T) {
+	samples := testSamples(4 * testWindowSize)
+	samples[10] = float32(math.NaN())
+	samples[200] = float32(math.Inf(1))
+	samples[300] = 3
+	for _, tc := range []struct {
+		clamp     bool
+		sanitized int64
+	}{
+		{false, 2},
+		{true, 3},
+	} {
+		p := NewPaulstretchWithOptions(2, testWindowSize, WithSanitizeInput(tc.clamp))
+		out := stretchAll(t, p, samples, func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+		for i, v := range out {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				t.Errorf("clamp %v: got non-finite stretched sample %v at %d", tc.clamp, v, i)
+				break
+			}
+		}
+		if sanitized := p.Stats().SamplesSanitized; sanitized != tc.sanitized {
+			t.Errorf("clamp %v: got %d samples sanitized, want %d", tc.clamp, sanitized, tc.sanitized)
+		}
+	}
+}
+
+func TestLatency(t *testing.T) {
+	p := NewPaulstretch(4, testWindowSize)
+	defer p.Close()
+	latency := p.Latency()
+	if latency <= 0 || latency > 4*testWindowSize {
+		t.Errorf("Latency: got %d, want a positive latency of at most a stretched window", latency)
+	}
+	// pitch shifting stretches more, then resamples the stretched audio back to the rate of the output
+	shifted := NewPaulstretchWithOptions(4, testWindowSize, WithPitchShift(12))
+	defer shifted.Close()
+	if got := shifted.Latency(); got < latency/4 || got > 4*latency {
+		t.Errorf("Latency with WithPitchShift: got %d, want about %d", got, latency)
+	}
+}
+
+func TestBufferedPending(t *testing.T) {
+	p := NewPaulstretch(1, testWindowSize)
+	defer p.Close()
+	if _, err := p.WriteSamples(testSamples(testWindowSize + 10)); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Buffered(); n != 10 {
+		t.Errorf("Buffered: got %d, want 10", n)
+	}
+	if _, err := p.Read(make([]byte, 24)); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Pending(); n != testWindowSize*4-24 {
+		t.Errorf("Pending: got %d, want %d", n, testWindowSize*4-24)
+	}
+	go io.Copy(io.Discard, p)
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Buffered(); n != 0 {
+		t.Errorf("Buffered after Flush: got %d, want 0", n)
+	}
+}
+
+func TestMaxOutputSamples(t *testing.T) {
+	const limit = 5*testWindowSize/2 + 3
+	p := NewPaulstretchWithOptions(4, testWindowSize, WithMaxOutputSamples(limit))
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.WriteSamples(testSamples(4 * testWindowSize))
+		done <- err
+	}()
+	var out []float32
+	buf := make([]float32, 100)
+	var err error
+	for err == nil {
+		var n int
+		n, err = p.ReadSamples(buf)
+		out = append(out, buf[:n]...)
+	}
+	if err != ErrOutputLimitExceeded || len(out) != limit {
+		t.Errorf("ReadSamples: got (%d samples, %v), want (%d samples, %v)", len(out), err, limit, ErrOutputLimitExceeded)
+	}
+	if n, ok := p.TryRead(make([]byte, 4)); n != 0 || ok {
+		t.Errorf("TryRead after the limit: got (%d, %v), want (0, false)", n, ok)
+	}
+	// the writer blocks until Close
+	p.Close()
+	if err := <-done; err != ErrClosed {
+		t.Errorf("WriteSamples after the limit: got error %v, want %v", err, ErrClosed)
+	}
+
+	// reaching the limit at the end of the stream is not an error
+	stretch := func(opts ...Option) []float32 {
+		p := NewPaulstretchWithOptions(2, testWindowSize, opts...)
+		return stretchAll(t, p, testSamples(4*testWindowSize), func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+	}
+	want := len(stretch())
+	if got := len(stretch(WithMaxOutputSamples(int64(want)))); got != want {
+		t.Errorf("ReadSamples with the limit at the end: got %d samples, want %d", got, want)
+	}
+}
+
+func TestCloseFlush(t *testing.T) {
+	samples := testSamples(5*testWindowSize + 7)
+	stretch := func(end func(p *Paulstretch) error) []float32 {
+		p := NewPaulstretch(2, testWindowSize)
+		done := make(chan error, 1)
+		go func() {
+			_, err := p.WriteSamples(samples)
+			if err == nil {
+				err = end(p)
+			}
+			done <- err
+		}()
+		out, err := readAll(p)
+		if err != nil {
+			t.Fatalf("ReadSamples: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("CloseFlush: %v", err)
+		}
+		return out
+	}
+	flushed := stretch((*Paulstretch).CloseFlush)
+	closed := stretch((*Paulstretch).Close)
+	estimate := NewPaulstretch(2, testWindowSize).EstimateOutputSamples(int64(len(samples)))
+	if d := estimate - int64(len(flushed)); d < -testWindowSize || d > testWindowSize {
+		t.Errorf("CloseFlush: got %d stretched samples, want %d within a window", len(flushed), estimate)
+	}
+	if len(closed) >= len(flushed) {
+		t.Errorf("Close: got %d stretched samples, want less than with CloseFlush (%d)", len(closed), len(flushed))
+	}
+
+	p := NewPaulstretch(2, testWindowSize)
+	p.Close()
+	if err := p.CloseFlush(); err != nil {
+		t.Errorf("CloseFlush after Close: got error %v, want nil", err)
+	}
+}
+
+func readAll(p *Paulstretch) ([]float32, error) {
+	var out []float32
+	buf := make([]float32, 100)
+	for {
+		n, err := p.ReadSamples(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+func TestCloseWithError(t *testing.T) {
+	errInput := errors.New("input error")
+	p := NewPaulstretch(2, testWindowSize)
+	out := make(chan error, 1)
+	go func() {
+		out <- func() error {
+			if _, err := p.WriteSamples(testSamples(3 * testWindowSize)); err != nil {
+				return err
+			}
+			p.CloseWithError(errInput)
+			p.CloseWithError(errors.New("ignored"))
+			return nil
+		}()
+	}()
+	samples, err := readAll(p)
+	if <-out != nil || err != errInput || len(samples) == 0 {
+		t.Errorf("Read after CloseWithError: got (%d samples, %v), want (some samples, %v)", len(samples), err, errInput)
+	}
+	if _, err := p.Read(make([]byte, 4)); err != errInput {
+		t.Errorf("Read again after CloseWithError: got error %v, want %v", err, errInput)
+	}
+}
+
+// TestIdentity checks that a stretch factor of 1 reproduces its input.
+func TestIdentity(t *testing.T) {
+	samples := make([]float32, 8*testWindowSize+11)
+	for i := range samples {
+		samples[i] = float32(0.5 * math.Sin(2*math.Pi*440*float64(i)/44100))
+	}
+	p := NewPaulstretch(1, testWindowSize)
+	latency := p.Latency()
+	out := stretchAll(t, p, samples, func(s []float32) error {
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	if len(out) < latency+len(samples) {
+		t.Fatalf("got %d stretched samples, want at least %d", len(out), latency+len(samples))
+	}
+	var xy, xx, yy float64
+	for i, x := range samples {
+		y := float64(out[latency+i])
+		xy += float64(x) * y
+		xx += float64(x) * float64(x)
+		yy += y * y
+	}
+	if c := xy / math.Sqrt(xx*yy); c < 0.99 {
+		t.Errorf("got a correlation of %v with the input, want at least 0.99", c)
+	}
+}
+
+func TestUnderrunSilence(t *testing.T) {
+	p := NewPaulstretchWithOptions(2, testWindowSize, WithUnderrunSilence())
+	buf := make([]float32, 10)
+	for i := range buf {
+		buf[i] = 1
+	}
+	if n, err := p.ReadSamples(buf); n != len(buf) || err != nil || buf[0] != 0 || buf[9] != 0 {
+		t.Fatalf("ReadSamples without input: got (%d, %v, %v), want (%d, nil) and silence", n, err, buf, len(buf))
+	}
+	if s := p.Stats(); s.Underruns != 1 || s.ReadStalls != 0 {
+		t.Errorf("Stats: got %d underruns and %d read stalls, want 1 and 0", s.Underruns, s.ReadStalls)
+	}
+	samples := testSamples(testWindowSize)
+	if _, err := p.WriteSamples(samples); err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	out, err := readAll(p)
+	if err != nil || len(out) < 2*len(samples) {
+		t.Errorf("ReadSamples after Close: got (%d samples, %v), want (at least %d samples, nil)", len(out), err, 2*len(samples))
+	}
+	if s := p.Stats(); s.Underruns != 1 || s.SamplesRead != int64(len(out)) {
+		t.Errorf("Stats: got %d underruns and %d samples read, want 1 and %d", s.Underruns, s.SamplesRead, len(out))
+	}
+}
+
+func TestReadAllAfterClose(t *testing.T) {
+	p := NewPaulstretchWithOptions(2, testWindowSize, WithOutputBuffers(16))
+	if _, err := p.ReadAllAfterClose(); err != ErrNotClosed {
+		t.Errorf("ReadAllAfterClose before Close: got error %v, want %v", err, ErrNotClosed)
+	}
+	samples := testSamples(3*testWindowSize + 5)
+	if _, err := p.WriteSamples(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CloseFlush(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := p.ReadAllAfterClose()
+	if err != nil || len(out) < 2*4*len(samples) {
+		t.Errorf("ReadAllAfterClose: got (%d bytes, %v), want (at least %d bytes, nil)", len(out), err, 2*4*len(samples))
+	}
+	if int64(cap(out)) < p.EstimateOutputSamples(int64(len(samples)))*4 {
+		t.Errorf("ReadAllAfterClose: got a capacity of %d bytes, want at least the estimate", cap(out))
+	}
+}
+
+// TestFinalizer drops the references to instances while they are written and read, with the garbage collector
+// running concurrently, to check that the finalizer never destroys the engines during a call to them.
+func TestFinalizer(t *testing.T) {
+	stop := make(chan struct{})
+	gcDone := make(chan struct{})
+	go func() {
+		defer close(gcDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				runtime.GC()
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				p := NewPaulstretch(2, testWindowSize)
+				go func() {
+					p.WriteSamples(testSamples(3 * testWindowSize))
+					p.CloseFlush()
+				}()
+				io.Copy(io.Discard, p)
+				// the instance is only referenced during the call to ProcessWindow
+				NewPaulstretch(2, testWindowSize).ProcessWindow(testSamples(testWindowSize))
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-gcDone
+}
+
+func TestWriteOnce(t *testing.T) {
+	samples := testSamples(3*testWindowSize + 10)
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	window := testWindowSize * 4
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithOutputBuffers(16))
+	defer p.Close()
+	for _, tc := range []struct {
+		data     []byte
+		n        int
+		windows  int64
+		buffered int
+	}{
+		{data[:40], 40, 0, 10},
+		{data[40:], window - 40, 1, 0},
+		{data[window:], window, 2, 0},
+		{data[2*window+3 : 2*window+3], 0, 2, 0},
+		{data[2*window:], window, 3, 0},
+		{data[3*window:], 40, 3, 10},
+	} {
+		n, err := p.WriteOnce(tc.data)
+		if n != tc.n || err != nil {
+			t.Fatalf("WriteOnce(%d bytes): got (%d, %v), want (%d, nil)", len(tc.data), n, err, tc.n)
+		}
+		if w, b := p.Stats().WindowsProcessed, p.Buffered(); w != tc.windows || b != tc.buffered {
+			t.Errorf("WriteOnce(%d bytes): got %d windows and %d samples buffered, want %d and %d", len(tc.data), w, b, tc.windows, tc.buffered)
+		}
+	}
+}
+
+// TestInvalid calls every method on instances that are not valid, and checks that they return errors
+// rather than crash.
+func TestInvalid(t *testing.T) {
+	released := NewPaulstretch(2, testWindowSize)
+	released.ReleaseBuffers()
+	for name, p := range map[string]*Paulstretch{"zero value": {}, "nil": nil, "released": released} {
+		if p.Valid() {
+			t.Errorf("%s: Valid: got true, want false", name)
+		}
+		if name == "nil" {
+			continue
+		}
+		b := make([]byte, 12)
+		samples := make([]float32, 3)
+		check := func(method string, err error, want ...error) {
+			t.Helper()
+			for _, w := range want {
+				if err == w {
+					return
+				}
+			}
+			t.Errorf("%s: %s: got error %v, want %v", name, method, err, want)
+		}
+		_, err := p.Write(b)
+		check("Write", err, ErrClosed)
+		_, err = p.WriteOnce(b)
+		check("WriteOnce", err, ErrClosed)
+		_, err = p.WriteSamples(samples)
+		check("WriteSamples", err, ErrClosed)
+		_, err = p.WriteSamples64(make([]float64, 3))
+		check("WriteSamples64", err, ErrClosed)
+		_, err = p.WriteInt24Samples(make([]byte, 3))
+		check("WriteInt24Samples", err, ErrClosed)
+		_, err = p.WriteFromAll(bytes.NewReader(b))
+		check("WriteFromAll", err, ErrClosed)
+		check("Flush", p.Flush(), ErrClosed)
+		_, err = p.Read(b)
+		check("Read", err, ErrClosed, io.EOF)
+		_, err = p.ReadSamples(samples)
+		check("ReadSamples", err, ErrClosed, io.EOF)
+		_, err = p.ReadSamples64(make([]float64, 3))
+		check("ReadSamples64", err, ErrClosed, io.EOF)
+		_, err = p.ReadInt24Samples(make([]byte, 3))
+		check("ReadInt24Samples", err, ErrClosed, io.EOF)
+		_, err = p.DrainTo(io.Discard)
+		check("DrainTo", err, ErrClosed, nil)
+		_, err = p.ReadAllAfterClose()
+		check("ReadAllAfterClose", err, ErrClosed, nil)
+		if n, ok := p.TryRead(b); n != 0 || ok {
+			t.Errorf("%s: TryRead: got (%d, %v), want (0, false)", name, n, ok)
+		}
+		_, err = p.ProcessWindow(samples)
+		check("ProcessWindow", err, ErrClosed)
+		check("SetReadDeadline", p.SetReadDeadline(time.Now()), ErrClosed, nil)
+		check("SetWriteDeadline", p.SetWriteDeadline(time.Now()), ErrClosed, nil)
+		p.SetSource(bytes.NewReader(b))
+		p.Freeze()
+		p.Unfreeze()
+		p.Buffered()
+		p.Pending()
+		p.Stats()
+		p.Parameters()
+		p.OptimalBufferSize()
+		p.OptimalWriteBufferSize()
+		p.EstimateOutputSamples(100)
+		p.Latency()
+		check("CloseFlush", p.CloseFlush(), ErrClosed, nil)
+		check("CloseWithError", p.CloseWithError(errors.New("error")), ErrClosed, nil)
+		check("Close", p.Close(), ErrClosed, nil)
+		p.ReleaseBuffers()
+	}
+}
+
+func TestReadFull(t *testing.T) {
+	p := NewPaulstretch(1, testWindowSize)
+	go func() {
+		p.WriteSamples(testSamples(2 * testWindowSize))
+		p.CloseFlush()
+	}()
+	// odd sizes, across the windows of stretched audio
+	window := testWindowSize * 4
+	for _, size := range []int{3, window, window - 3} {
+		if n, err := p.ReadFull(make([]byte, size)); n != size || err != nil {
+			t.Errorf("ReadFull(%d bytes): got (%d, %v), want (%d, nil)", size, n, err, size)
+		}
+	}
+	if n, err := p.ReadFull(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("ReadFull at the end: got (%d, %v), want (0, EOF)", n, err)
+	}
+
+	p = NewPaulstretch(1, testWindowSize)
+	go func() {
+		p.WriteSamples(testSamples(testWindowSize))
+		p.CloseFlush()
+	}()
+	if n, err := p.ReadFull(make([]byte, window+4)); n != window || err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFull past the end: got (%d, %v), want (%d, %v)", n, err, window, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestReadLarge(t *testing.T) {
+	const stretchFactor = 4
+	p := NewPaulstretch(stretchFactor, testWindowSize)
+	if _, err := p.WriteSamples(testSamples(testWindowSize)); err != nil {
+		t.Fatalf("WriteSamples: %v", err)
+	}
+	if err := p.CloseFlush(); err != nil {
+		t.Fatalf("CloseFlush: %v", err)
+	}
+	// all the windows stretched from the window written are available at once
+	data := make([]byte, 2*stretchFactor*testWindowSize*4)
+	n, err := p.Read(data)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if want := stretchFactor * testWindowSize * 4; n != want {
+		t.Errorf("Read: got %d bytes, want %d", n, want)
+	}
+	if n, err := p.Read(data); n != 0 || err != io.EOF {
+		t.Errorf("Read at the end: got (%d, %v), want (0, EOF)", n, err)
+	}
+}
+
+func TestReadSamplesIntoAllocs(t *testing.T) {
+	const stretchFactor = 8
+	p := NewPaulstretchWithOptions(stretchFactor, testWindowSize, WithChannels(2))
+	if _, err := p.WriteSamples(testSamples(2 * testWindowSize)); err != nil {
+		t.Fatalf("WriteSamples: %v", err)
+	}
+	samples := make([]float32, p.OptimalBufferSize())
+	// AllocsPerRun calls the function once more to warm up: read all the windows stretched from the window written
+	if allocs := testing.AllocsPerRun(stretchFactor-1, func() {
+		if n, err := p.ReadSamplesInto(samples); n != len(samples) || err != nil {
+			t.Fatalf("ReadSamplesInto: got (%d, %v), want (%d, nil)", n, err, len(samples))
+		}
+	}); allocs != 0 {
+		t.Errorf("ReadSamplesInto: got %v allocations, want 0", allocs)
+	}
+}
+
+func BenchmarkReadSamplesInto(b *testing.B) {
+	p := NewPaulstretchWithOptions(8, WindowSizeForDuration(DefaultWindowDuration, 44100), WithChannels(2))
+	in := testSamples(p.OptimalWriteBufferSize())
+	go func() {
+		for {
+			if _, err := p.WriteSamples(in); err != nil {
+				return
+			}
+		}
+	}()
+	defer p.Close()
+	samples := make([]float32, p.OptimalBufferSize())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ReadSamplesInto(samples); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestConcurrentRead reads the stretched audio from several goroutines while it is written: run it with -race.
+func TestConcurrentRead(t *testing.T) {
+	p := NewPaulstretchWithOptions(3, testWindowSize, WithChannels(2))
+	const inputSamples = 20*2*testWindowSize + 6
+	go func() {
+		p.WriteSamples(testSamples(inputSamples))
+		p.CloseFlush()
+	}()
+	var wg sync.WaitGroup
+	var total int64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// odd sizes, so that reads stop in the middle of windows
+			buf := make([]float32, 37+i*50)
+			n := 0
+			for {
+				var m int
+				var err error
+				switch i {
+				case 0:
+					m, err = p.ReadSamples(buf)
+				case 1:
+					m, err = p.ReadSamples64(make([]float64, len(buf)))
+				case 2:
+					var ok bool
+					if m, ok = p.TryRead(make([]byte, len(buf)*4)); ok {
+						m /= 4
+					} else {
+						_, err = p.Read(nil)
+						runtime.Gosched()
+					}
+				default:
+					var b [4 * 100]byte
+					m, err = p.Read(b[:])
+					m /= 4
+				}
+				n += m
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Errorf("read: %v", err)
+					break
+				}
+			}
+			atomic.AddInt64(&total, int64(n))
+		}(i)
+	}
+	wg.Wait()
+	if want := p.EstimateOutputSamples(inputSamples); total != want {
+		t.Errorf("got %d stretched samples, want %d", total, want)
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	// the reader abandoned the stream, while Write is blocked
+	p := NewPaulstretch(2, testWindowSize)
+	written := make(chan error, 1)
+	go func() {
+		_, err := p.WriteSamples(testSamples(8 * testWindowSize))
+		written <- err
+	}()
+	if _, err := p.Read(make([]byte, 4)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err := p.CloseTimeout(10 * time.Millisecond); err != ErrDeadlineExceeded {
+		t.Errorf("CloseTimeout: got error %v, want %v", err, ErrDeadlineExceeded)
+	}
+	if err := <-written; err != ErrClosed {
+		t.Errorf("WriteSamples: got error %v, want %v", err, ErrClosed)
+	}
+	if _, err := p.Read(make([]byte, 4)); err != ErrDeadlineExceeded {
+		t.Errorf("Read after CloseTimeout: got error %v, want %v", err, ErrDeadlineExceeded)
+	}
+
+	// the reader reads all the stretched audio
+	p = NewPaulstretch(2, testWindowSize)
+	go io.Copy(io.Discard, p)
+	p.WriteSamples(testSamples(2 * testWindowSize))
+	p.Flush()
+	if err := p.CloseTimeout(5 * time.Second); err != nil {
+		t.Errorf("CloseTimeout: got error %v, want nil", err)
+	}
+}
+
+// TestCloseBlockedWrite closes Paulstretch while Write is blocked waiting for Read: run it with -race.
+func TestCloseBlockedWrite(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChannels(2)}, {WithOutputBuffers(2)}} {
+		p := NewPaulstretchWithOptions(2, testWindowSize, opts...)
+		samples := testSamples(8 * 2 * testWindowSize)
+		written := make(chan int, 1)
+		go func() {
+			n, err := p.WriteSamples(samples)
+			if err != ErrClosed {
+				t.Errorf("WriteSamples: got error %v, want %v", err, ErrClosed)
+			}
+			written <- n
+		}()
+		// wait for Write to block
+		for p.Stats().WriteStalls == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		windows := p.Stats().WindowsProcessed
+		p.Close()
+		if n := <-written; n == 0 || n >= len(samples) {
+			t.Errorf("WriteSamples: got %d samples written, want some of %d", n, len(samples))
+		}
+		if got := p.Stats().WindowsProcessed; got != windows {
+			t.Errorf("WriteSamples: got %d windows processed after Close, want %d", got, windows)
+		}
+		if n, err := p.WriteSamples(samples); n != 0 || err != ErrClosed {
+			t.Errorf("WriteSamples after Close: got (%d, %v), want (0, %v)", n, err, ErrClosed)
+		}
+	}
+}
+
+func TestWriteAligned(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChannels(2)}, {WithByteOrder(binary.BigEndian)}} {
+		p := NewPaulstretchWithOptions(2, testWindowSize, opts...)
+		ref := NewPaulstretchWithOptions(2, testWindowSize, opts...)
+		for _, p := range []*Paulstretch{p, ref} {
+			for c := range p.ps {
+				p.ps[c].destroy()
+				p.ps[c] = &identityEngine{}
+			}
+		}
+		samples := testSamples(4 * p.OptimalWriteBufferSize())
+		want := stretchAll(t, ref, samples, func(s []float32) error {
+			_, err := ref.WriteSamples(s)
+			return err
+		}, ref.ReadSamples)
+		got := stretchAll(t, p, samples, func(s []float32) error {
+			for len(s) > 0 {
+				n, err := p.WriteAligned(s[:p.OptimalWriteBufferSize()])
+				if err != nil {
+					return err
+				}
+				s = s[n:]
+			}
+			return nil
+		}, p.ReadSamples)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("WriteAligned: got %d stretched samples, want the %d samples of WriteSamples", len(got), len(want))
+		}
+	}
+
+	p := NewPaulstretch(2, testWindowSize)
+	if _, err := p.WriteAligned(testSamples(testWindowSize - 1)); err != ErrNotAligned {
+		t.Errorf("WriteAligned with a short window: got error %v, want %v", err, ErrNotAligned)
+	}
+	p.WriteSamples(testSamples(1))
+	if _, err := p.WriteAligned(testSamples(testWindowSize)); err != ErrNotAligned {
+		t.Errorf("WriteAligned after a partial window: got error %v, want %v", err, ErrNotAligned)
+	}
+}
+
+// discardAll reads all the stretched audio of p with ReadSamplesInto, which does not allocate.
+func discardAll(p *Paulstretch) {
+	samples := make([]float32, p.OptimalBufferSize())
+	for {
+		if _, err := p.ReadSamplesInto(samples); err != nil {
+			return
+		}
+	}
+}
+
+// TestWriteAlignedAllocs checks that writing windows with Write at a zero offset in the window does not allocate.
+func TestWriteAlignedAllocs(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		p := NewPaulstretchWithOptions(2, testWindowSize, WithChannels(channels))
+		in := testSamples(2 * p.OptimalWriteBufferSize())
+		data := unsafe.Slice((*byte)(unsafe.Pointer(&in[0])), len(in)*4)
+		done := make(chan struct{})
+		go func() {
+			discardAll(p)
+			close(done)
+		}()
+		if allocs := testing.AllocsPerRun(100, func() {
+			if n, err := p.Write(data); n != len(data) || err != nil {
+				t.Fatalf("Write: got (%d, %v), want (%d, nil)", n, err, len(data))
+			}
+		}); allocs != 0 {
+			t.Errorf("%d channels: Write: got %v allocations, want 0", channels, allocs)
+		}
+		p.Close()
+		<-done
+	}
+}
+
+func BenchmarkWriteAligned(b *testing.B) {
+	p := NewPaulstretch(1, WindowSizeForDuration(DefaultWindowDuration, 44100))
+	go discardAll(p)
+	defer p.Close()
+	in := testSamples(p.OptimalWriteBufferSize())
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&in[0])), len(in)*4)
+	b.Run("WriteAligned", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.WriteAligned(in); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Write", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.Write(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package paulstretch
+
+import "math"
+
+// int16Scale and int32Scale are the scales of 16-bit and 32-bit signed PCM samples, which are
+// in [-scale, scale-1].
+const (
+	int16Scale = 1 << 15
+	int32Scale = 1 << 31
+)
+
+// WriteInt16Samples is like WriteSamples, for 16-bit signed PCM samples, so that callers do not convert them
+// with unsafe or by hand. The samples are scaled by 1/32768 to [-1, 1).
+func (p *Paulstretch) WriteInt16Samples(samples []int16) (int, error) {
+	if cap(p.writeConv) < len(samples) {
+		p.writeConv = make([]float32, len(samples))
+	}
+	p.writeConv = p.writeConv[:len(samples)]
+	for i, v := range samples {
+		p.writeConv[i] = float32(v) / int16Scale
+	}
+	return p.WriteSamples(p.writeConv)
+}
+
+// ReadInt16Samples is like ReadSamples, for 16-bit signed PCM samples. The stretched samples are scaled by 32768,
+// dithered with WithDither, rounded, and clamped to the 16-bit range.
+func (p *Paulstretch) ReadInt16Samples(samples []int16) (int, error) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	if cap(p.readConv) < len(samples) {
+		p.readConv = make([]float32, len(samples))
+	}
+	p.readConv = p.readConv[:len(samples)]
+	n, err := p.readSamples(p.readConv)
+	for i, v := range p.readConv[:n] {
+		f := float64(v) * int16Scale
+		if p.dither != nil {
+			f += p.dither.next()
+		}
+		samples[i] = int16(math.Max(-int16Scale, math.Min(int16Scale-1, math.Round(f))))
+	}
+	return n, err
+}
+
+// WriteInt32Samples is like WriteSamples, for 32-bit signed PCM samples. The samples are scaled by 1/2147483648
+// to [-1, 1). Paulstretch processes audio in single precision, which keeps the 24 most significant bits of each sample.
+func (p *Paulstretch) WriteInt32Samples(samples []int32) (int, error) {
+	if cap(p.writeConv) < len(samples) {
+		p.writeConv = make([]float32, len(samples))
+	}
+	p.writeConv = p.writeConv[:len(samples)]
+	for i, v := range samples {
+		p.writeConv[i] = float32(float64(v) / int32Scale)
+	}
+	return p.WriteSamples(p.writeConv)
+}
+
+// ReadInt32Samples is like ReadSamples, for 32-bit signed PCM samples. The stretched samples are scaled
+// by 2147483648, rounded, and clamped to the 32-bit range. They are not dithered: single precision samples
+// have less resolution than 32-bit samples.
+func (p *Paulstretch) ReadInt32Samples(samples []int32) (int, error) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	if cap(p.readConv) < len(samples) {
+		p.readConv = make([]float32, len(samples))
+	}
+	p.readConv = p.readConv[:len(samples)]
+	n, err := p.readSamples(p.readConv)
+	for i, v := range p.readConv[:n] {
+		samples[i] = int32(math.Max(-int32Scale, math.Min(int32Scale-1, math.Round(float64(v)*int32Scale))))
+	}
+	return n, err
+}
@@ -0,0 +1,80 @@
+package paulstretch
+
+import "testing"
+
+func TestInt16Samples(t *testing.T) {
+	// the extremes of the 16-bit range, and values around 0
+	samples := []int16{-32768, -32767, -1, 0, 1, 32766, 32767}
+	for _, tc := range []struct {
+		sample int16
+		want   float32
+	}{
+		{-32768, -1},
+		{0, 0},
+		{1, 1.0 / 32768},
+		{32767, 32767.0 / 32768},
+	} {
+		// a stretch factor of 1 passes the audio through
+		p := NewPaulstretch(1, testWindowSize)
+		if _, err := p.WriteInt16Samples([]int16{tc.sample}); err != nil {
+			t.Fatal(err)
+		}
+		p.CloseFlush()
+		out := make([]float32, 1)
+		if _, err := p.ReadSamples(out); err != nil || out[0] != tc.want {
+			t.Errorf("WriteInt16Samples(%d): got sample (%v, %v), want %v", tc.sample, out[0], err, tc.want)
+		}
+	}
+
+	// round trip
+	p := NewPaulstretch(1, testWindowSize)
+	go func() {
+		p.WriteInt16Samples(samples)
+		p.CloseFlush()
+	}()
+	out := make([]int16, len(samples))
+	if n, err := p.ReadInt16Samples(out); err != nil || n != len(out) {
+		t.Fatalf("ReadInt16Samples: got (%d, %v), want (%d, nil)", n, err, len(out))
+	}
+	for i, v := range out {
+		if v != samples[i] {
+			t.Errorf("ReadInt16Samples: got sample %d = %d, want %d", i, v, samples[i])
+		}
+	}
+
+	// clamping of the stretched samples out of range
+	p = NewPaulstretch(1, testWindowSize)
+	p.WriteSamples([]float32{-2, 2})
+	p.CloseFlush()
+	out = make([]int16, 2)
+	if _, err := p.ReadInt16Samples(out); err != nil || out[0] != -32768 || out[1] != 32767 {
+		t.Errorf("ReadInt16Samples out of range: got (%v, %v), want ([-32768 32767], nil)", out, err)
+	}
+}
+
+func TestInt32Samples(t *testing.T) {
+	// values with at most 24 significant bits, kept exactly in single precision
+	samples := []int32{-2147483648, -256, 0, 256, 2147483392}
+	p := NewPaulstretch(1, testWindowSize)
+	go func() {
+		p.WriteInt32Samples(samples)
+		p.CloseFlush()
+	}()
+	out := make([]int32, len(samples))
+	if n, err := p.ReadInt32Samples(out); err != nil || n != len(out) {
+		t.Fatalf("ReadInt32Samples: got (%d, %v), want (%d, nil)", n, err, len(out))
+	}
+	for i, v := range out {
+		if v != samples[i] {
+			t.Errorf("ReadInt32Samples: got sample %d = %d, want %d", i, v, samples[i])
+		}
+	}
+
+	// clamping of the stretched samples out of range
+	p = NewPaulstretch(1, testWindowSize)
+	p.WriteSamples([]float32{-2, 2})
+	p.CloseFlush()
+	if _, err := p.ReadInt32Samples(out[:2]); err != nil || out[0] != -2147483648 || out[1] != 2147483647 {
+		t.Errorf("ReadInt32Samples out of range: got (%v, %v), want ([-2147483648 2147483647], nil)", out[:2], err)
+	}
+}
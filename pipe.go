@@ -0,0 +1,101 @@
+package paulstretch
+
+import (
+	"io"
+	"sync"
+)
+
+// pipe is the Paulstretch shared by the ends returned by Pipe, whose buffers are released once both ends
+// are closed.
+type pipe struct {
+	p      *Paulstretch
+	mu     sync.Mutex
+	closed int // ends closed
+}
+
+// closeEnd records that an end of the pipe is closed, and releases the buffers of Paulstretch once both are.
+func (pp *pipe) closeEnd() {
+	pp.mu.Lock()
+	pp.closed++
+	release := pp.closed == 2
+	pp.mu.Unlock()
+	if release {
+		pp.p.ReleaseBuffers()
+	}
+}
+
+// Writer is the input end of a Paulstretch returned by Pipe: it can only write audio to be stretched.
+type Writer struct {
+	pipe *pipe
+	once sync.Once
+}
+
+// Reader is the output end of a Paulstretch returned by Pipe: it can only read the stretched audio.
+type Reader struct {
+	pipe *pipe
+	once sync.Once
+}
+
+// Pipe returns the input and output ends of a new Paulstretch of the stretch factor and window size of
+// NewPaulstretch, as distinct values, like io.Pipe: the Writer can be handed to the goroutine writing the audio,
+// and the Reader to the goroutine reading the stretched audio, so that neither can misuse the other end.
+//
+// Closing the Writer flushes the audio written, and the Reader then returns the rest of the stretched audio,
+// then EOF. Closing the Reader abandons the stretched audio: Write then returns ErrClosed. The buffers
+// of Paulstretch are released, as with ReleaseBuffers, once both ends are closed.
+func Pipe(stretchFactor float64, windowSize int) (*Writer, *Reader) {
+	pp := &pipe{p: NewPaulstretch(stretchFactor, windowSize)}
+	return &Writer{pipe: pp}, &Reader{pipe: pp}
+}
+
+// Write writes bytes of an audio sample stream to the Paulstretch of the pipe, like Paulstretch.Write.
+func (w *Writer) Write(data []byte) (int, error) {
+	return w.pipe.p.Write(data)
+}
+
+// WriteSamples writes samples to the Paulstretch of the pipe, like Paulstretch.WriteSamples.
+func (w *Writer) WriteSamples(samples []float32) (int, error) {
+	return w.pipe.p.WriteSamples(samples)
+}
+
+// Close flushes the samples written and closes the input end, like Paulstretch.CloseFlush: the Reader returns
+// the rest of the stretched audio, then EOF. Close may block until the Reader reads enough stretched audio.
+// Calling Close again does nothing.
+func (w *Writer) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError closes the input end like Close, without flushing the samples written that do not yet fill
+// a window if err is not nil: the Reader then returns err instead of EOF, like Paulstretch.CloseWithError.
+func (w *Writer) CloseWithError(err error) error {
+	var cerr error
+	w.once.Do(func() {
+		if err == nil {
+			cerr = w.pipe.p.CloseFlush()
+		} else {
+			cerr = w.pipe.p.CloseWithError(err)
+		}
+		w.pipe.closeEnd()
+	})
+	return cerr
+}
+
+// Read reads bytes of the stretched audio sample stream from the Paulstretch of the pipe, like Paulstretch.Read.
+func (r *Reader) Read(data []byte) (int, error) {
+	return r.pipe.p.Read(data)
+}
+
+// ReadSamples reads stretched samples from the Paulstretch of the pipe, like Paulstretch.ReadSamples.
+func (r *Reader) ReadSamples(samples []float32) (int, error) {
+	return r.pipe.p.ReadSamples(samples)
+}
+
+// Close closes the output end, discarding the stretched audio not yet read: the calls to Write of the Writer,
+// including those in progress, then return ErrClosed. Calling Close again does nothing.
+func (r *Reader) Close() error {
+	r.once.Do(func() {
+		r.pipe.p.CloseWithError(io.ErrClosedPipe)
+		r.pipe.closeEnd()
+	})
+	return nil
+}
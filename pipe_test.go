@@ -0,0 +1,66 @@
+package paulstretch
+
+import (
+	"io"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	w, r := Pipe(2, testWindowSize)
+	samples := testSamples(3*testWindowSize + 7)
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.WriteSamples(samples)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		done <- err
+	}()
+	got := 0
+	buf := make([]float32, 100)
+	for {
+		n, err := r.ReadSamples(buf)
+		got += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadSamples: %v", err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if want := NewPaulstretch(2, testWindowSize).EstimateOutputSamples(int64(len(samples))); int64(got) != want {
+		t.Errorf("got %d stretched samples, want %d", got, want)
+	}
+	r.Close()
+	if w.pipe.p.Valid() {
+		t.Error("Paulstretch still valid after both ends were closed")
+	}
+}
+
+func TestPipeReaderClose(t *testing.T) {
+	w, r := Pipe(2, testWindowSize)
+	done := make(chan error, 1)
+	go func() {
+		// blocks once the stretched audio is not read
+		_, err := w.WriteSamples(testSamples(100 * testWindowSize))
+		done <- err
+	}()
+	buf := make([]byte, 100)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	r.Close()
+	if err := <-done; err != ErrClosed {
+		t.Errorf("Write after the Reader is closed: got error %v, want %v", err, ErrClosed)
+	}
+	if !w.pipe.p.Valid() {
+		t.Error("Paulstretch released before the Writer was closed")
+	}
+	w.Close()
+	if w.pipe.p.Valid() {
+		t.Error("Paulstretch still valid after both ends were closed")
+	}
+}
@@ -0,0 +1,126 @@
+package paulstretch
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// bufferPools holds a *sync.Pool of byte buffers of each capacity, reused across Paulstretch instances
+// to avoid allocating large buffers for each short-lived instance.
+//
+// The pooled buffers can contain audio of a previous instance: Paulstretch always overwrites its buffers
+// before reading from them, so this audio never leaks into another stream.
+var bufferPools sync.Map
+
+// getBuffer returns a byte buffer of length 0 and capacity size, either reused or newly allocated.
+func getBuffer(size int) []byte {
+	if pool, ok := bufferPools.Load(size); ok {
+		if b, ok := pool.(*sync.Pool).Get().(*[]byte); ok {
+			return (*b)[:0]
+		}
+	}
+	return make([]byte, 0, size)
+}
+
+// putBuffer returns a buffer obtained from getBuffer for reuse. The buffer must not be used afterwards.
+func putBuffer(b []byte) {
+	if b == nil {
+		return
+	}
+	pool, _ := bufferPools.LoadOrStore(cap(b), &sync.Pool{})
+	pool.(*sync.Pool).Put(&b)
+}
+
+// ReleaseBuffers closes Paulstretch, discards any stretched audio not yet read, and returns its internal buffers
+// for reuse by new instances, which avoids allocating large buffers for each instance when many are created.
+//
+// After ReleaseBuffers, Read returns EOF, and Paulstretch must not be used anymore. Calling ReleaseBuffers is optional:
+// the buffers of an instance that is no longer referenced are also reused, once it is garbage collected.
+//
+// ReleaseBuffers waits until the Write, Flush and Read calls in progress, which return ErrClosed (or EOF for Read)
+// since Paulstretch is closed, no longer use the buffers.
+func (p *Paulstretch) ReleaseBuffers() {
+	if !p.initialized() {
+		return
+	}
+	p.Close()
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.released {
+		return
+	}
+	p.released = true
+	for p.users > 0 {
+		p.rwCond.Wait()
+	}
+	p.putBuffers()
+}
+
+// releaseBuffers returns the internal buffers to the pools, if not done already. It is only called by the finalizer,
+// when no call can use the buffers anymore.
+func (p *Paulstretch) releaseBuffers() {
+	if p.released {
+		return
+	}
+	p.released = true
+	p.putBuffers()
+}
+
+// Valid returns whether Paulstretch is usable: created by one of the constructors (rather than a zero value,
+// or a nil pointer), and whose buffers were not released with ReleaseBuffers.
+//
+// The methods of a Paulstretch that is not valid do not crash: they return ErrClosed, or EOF for Read
+// after ReleaseBuffers, and do nothing otherwise.
+func (p *Paulstretch) Valid() bool {
+	if !p.initialized() {
+		return false
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	return !p.released
+}
+
+// initialized returns whether Paulstretch was created by one of the constructors.
+func (p *Paulstretch) initialized() bool {
+	return p != nil && p.rwCond.L != nil
+}
+
+// enter registers a Write, Flush or Read call using the internal buffers, and returns false if they were released.
+//
+// The call must defer leave right away: besides unregistering it, the deferred call keeps Paulstretch reachable
+// until the call returns, so that the finalizer cannot destroy the engines during a call to them.
+func (p *Paulstretch) enter() bool {
+	if !p.initialized() {
+		return false
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.released {
+		return false
+	}
+	p.users++
+	return true
+}
+
+// leave unregisters a call registered with enter.
+func (p *Paulstretch) leave() {
+	p.rwCond.L.Lock()
+	p.users--
+	if p.users == 0 && p.released {
+		// wake up ReleaseBuffers
+		p.rwCond.Broadcast()
+	}
+	p.rwCond.L.Unlock()
+}
+
+// putBuffers returns the internal buffers to the pools.
+func (p *Paulstretch) putBuffers() {
+	putBuffer(p.writeBuf)
+	putBuffer(p.readBuf)
+	p.writeBuf = nil
+	p.writeOff = 0
+	p.readBuf = nil
+	p.readOff = 0
+	atomic.StoreInt64(&p.stats.buffered, 0)
+	atomic.StoreInt64(&p.stats.pending, 0)
+}
@@ -0,0 +1,69 @@
+package paulstretch
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Prime feeds silence to Paulstretch before the audio to stretch, for its overlapping windows not to start empty,
+// and discards the stretched audio of that silence from Read, so that the stretched audio starts without the
+// transient of the first windows. Prime must be called before writing any sample, and returns ErrAlreadyWritten
+// otherwise.
+//
+// samples is the number of frames (samples per channel) of silence, rounded up to whole windows. The stretched
+// audio of the silence is discarded as it is read, before the processing of WithFade, WithLimiter and
+// WithDCBlock, so that the stretched audio read, Latency and InputPositionForOutput are the same as without the
+// silence, and only the stretched audio of the first windows changes. Like Write, Prime may block until Read
+// is called, and returns ErrClosed if Paulstretch is closed.
+func (p *Paulstretch) Prime(samples int) (err error) {
+	defer p.canceledErr(&err)
+	if !p.enter() {
+		return ErrClosed
+	}
+	defer p.leave()
+	if p.isClosed() {
+		return ErrClosed
+	}
+	if p.source != nil {
+		return ErrSource
+	}
+	if atomic.LoadInt64(&p.stats.bytesWritten) > 0 || p.writeOff > 0 || len(p.resampled) > 0 {
+		return ErrAlreadyWritten
+	}
+	windows := (samples + p.windowSize - 1) / p.windowSize
+	if windows <= 0 {
+		return nil
+	}
+	// each window of silence is written once: with an envelope, the engines stretch by a factor of 1
+	factor := p.stretchFactor
+	if p.envelope != nil {
+		factor = 1
+	}
+	p.rwCond.L.Lock()
+	p.skip += int64(math.Round(float64(windows*p.windowSize) * factor))
+	p.rwCond.L.Unlock()
+	p.priming = true
+	defer func() {
+		p.priming = false
+	}()
+	silence := make([]byte, len(p.writeBuf))
+	for i := 0; i < windows; i++ {
+		if err := p.submit(silence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard discards the first frames of the stretched audio of the silence of Prime from the next n frames
+// of stretched audio, and returns the number of frames to discard.
+func (p *Paulstretch) discard(n int) int {
+	if p.skip == 0 {
+		return 0
+	}
+	if int64(n) > p.skip {
+		n = int(p.skip)
+	}
+	p.skip -= int64(n)
+	return n
+}
@@ -0,0 +1,50 @@
+package paulstretch
+
+import "testing"
+
+func TestPrime(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		p := NewPaulstretchWithOptions(1, testWindowSize, WithChannels(channels))
+		for c := range p.ps {
+			p.ps[c].destroy()
+			p.ps[c] = &identityEngine{}
+		}
+		samples := testSamples(2 * testWindowSize * channels)
+		out := stretchAll(t, p, samples, func(s []float32) error {
+			if err := p.Prime(testWindowSize + 1); err != nil {
+				return err
+			}
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+		// the 2 windows of silence are discarded
+		if len(out) != len(samples) {
+			t.Fatalf("%d channels: got %d samples, want %d", channels, len(out), len(samples))
+		}
+		for i, v := range out {
+			if v != samples[i] {
+				t.Fatalf("%d channels: got sample %d = %v, want %v", channels, i, v, samples[i])
+			}
+		}
+	}
+
+	p := NewPaulstretch(2, testWindowSize)
+	samples := testSamples(3*testWindowSize + 5)
+	out := stretchAll(t, p, samples, func(s []float32) error {
+		if err := p.Prime(testWindowSize); err != nil {
+			return err
+		}
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	if want := p.EstimateOutputSamples(int64(len(samples))); int64(len(out)) != want {
+		t.Errorf("got %d stretched samples, want %d", len(out), want)
+	}
+
+	p = NewPaulstretch(2, testWindowSize)
+	defer p.Close()
+	p.WriteSamples(testSamples(10))
+	if err := p.Prime(testWindowSize); err != ErrAlreadyWritten {
+		t.Errorf("Prime after Write: got error %v, want %v", err, ErrAlreadyWritten)
+	}
+}
@@ -0,0 +1,71 @@
+package paulstretch
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// ProcessWindow stretches exactly one window of samples synchronously, and returns the zero or more windows
+// of stretched samples it produced, as the lowest-level alternative to the pipe-like Write and Read.
+//
+// in must be exactly OptimalWriteBufferSize samples: a window of frames, interleaved for multichannel audio.
+// The caller is responsible for buffering partial windows, and for calling ProcessWindow with a window of
+// silence to stretch the end of the stream, as Flush would. The returned windows are newly allocated,
+// and processed as with Read (with WithPitchShift, they can be of different sizes).
+//
+// ProcessWindow never blocks and does not lock Paulstretch: it must not be called concurrently with itself,
+// nor be mixed with Write, Flush or Read on the same Paulstretch. WithOutputBuffers and WithResample are ignored.
+// ProcessWindow returns ErrInvalidWindow if in is not a full window, and ErrClosed if Paulstretch is closed.
+func (p *Paulstretch) ProcessWindow(in []float32) (out [][]float32, err error) {
+	if !p.initialized() || p.closed || p.released {
+		return nil, ErrClosed
+	}
+	// ProcessWindow does not call enter and leave: keep p reachable until the end of its calls to the engines,
+	// so that the finalizer cannot destroy them in the meantime
+	defer runtime.KeepAlive(p)
+	if len(in) != p.windowSize*p.channels {
+		return nil, ErrInvalidWindow
+	}
+	repeats := 1
+	if p.envelope != nil {
+		repeats = p.envelope.next(p.windowSize)
+	}
+	onset := false
+	if !p.direct {
+		copy(p.inFrames, in)
+		if p.sanitize {
+			p.sanitizeInput()
+		}
+		p.deinterleave()
+		onset = p.onset != nil && p.onset.detect(p.inFrames, p.channels)
+	}
+	for ; repeats > 0; repeats-- {
+		if p.direct {
+			p.ps[0].write(in)
+		} else {
+			for c, in := range p.inSamples {
+				p.ps[c].write(in)
+			}
+		}
+		mix := float32(0)
+		if onset {
+			copy(p.dry, p.inFrames)
+			mix = float32(p.onset.sensitivity)
+			onset = false
+		}
+		for p.read(p.outSamples) {
+			var frames []float32
+			if p.direct {
+				frames = p.outSamples[0]
+			} else {
+				frames = p.process(mix, false)
+				mix = 0
+			}
+			out = append(out, append([]float32(nil), frames...))
+			atomic.AddInt64(&p.stats.bytesRead, int64(len(frames)*4))
+		}
+	}
+	atomic.AddInt64(&p.stats.bytesWritten, int64(len(in)*4))
+	atomic.AddInt64(&p.stats.windows, 1)
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package paulstretch
+
+import "testing"
+
+func TestProcessWindow(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChannels(2)}, {WithGain(-6)}} {
+		p := NewPaulstretchWithOptions(3, testWindowSize, opts...)
+		size := p.OptimalWriteBufferSize()
+		windows := 0
+		for i := 0; i < 8; i++ {
+			out, err := p.ProcessWindow(testSamples(size))
+			if err != nil {
+				t.Fatalf("ProcessWindow: %v", err)
+			}
+			for _, w := range out {
+				if len(w) != size {
+					t.Errorf("ProcessWindow: got a window of %d samples, want %d", len(w), size)
+				}
+			}
+			windows += len(out)
+		}
+		// 3 windows of stretched samples per window, to within a window
+		if windows < 3*8-3 || windows > 3*8+3 {
+			t.Errorf("ProcessWindow: got %d windows of stretched samples, want about %d", windows, 3*8)
+		}
+		if _, err := p.ProcessWindow(testSamples(size - 1)); err != ErrInvalidWindow {
+			t.Errorf("ProcessWindow of a partial window: got error %v, want %v", err, ErrInvalidWindow)
+		}
+		p.Close()
+		if _, err := p.ProcessWindow(testSamples(size)); err != ErrClosed {
+			t.Errorf("ProcessWindow after Close: got error %v, want %v", err, ErrClosed)
+		}
+	}
+}
+
+func BenchmarkProcessWindow(b *testing.B) {
+	p := NewPaulstretch(8, WindowSizeForDuration(DefaultWindowDuration, 44100))
+	defer p.Close()
+	in := testSamples(p.OptimalWriteBufferSize())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ProcessWindow(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
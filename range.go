@@ -0,0 +1,28 @@
+package paulstretch
+
+import "math"
+
+// sampleRange is a range of samples of WithInputRange and WithOutputRange, mapped linearly to [-1, 1].
+type sampleRange struct {
+	min, max float64
+}
+
+// newSampleRange returns the range [min, max], or nil if it is [-1, 1] or invalid.
+func newSampleRange(min, max float64) *sampleRange {
+	if !(min < max) || math.IsInf(min, 0) || math.IsInf(max, 0) || (min == -1 && max == 1) {
+		return nil
+	}
+	return &sampleRange{min: min, max: max}
+}
+
+// toUnit maps a sample of the range to [-1, 1], clamping it to the range.
+func (r *sampleRange) toUnit(v float32) float32 {
+	f := (float64(v)-r.min)/(r.max-r.min)*2 - 1
+	return float32(math.Max(-1, math.Min(1, f)))
+}
+
+// fromUnit maps a sample of [-1, 1] to the range, clamping it to [-1, 1].
+func (r *sampleRange) fromUnit(v float32) float32 {
+	f := math.Max(-1, math.Min(1, float64(v)))
+	return float32(r.min + (f+1)/2*(r.max-r.min))
+}
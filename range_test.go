@@ -0,0 +1,62 @@
+package paulstretch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	samples := testSamples(4 * testWindowSize)
+	unit := make([]float32, len(samples))
+	for i, v := range samples {
+		unit[i] = (v + 1) / 2
+	}
+	// a stretch factor of 1 passes the audio through: mapping to [0, 1] and back is the identity
+	p := NewPaulstretchWithOptions(1, testWindowSize, WithInputRange(0, 1), WithOutputRange(0, 1))
+	got := stretchAll(t, p, unit, func(s []float32) error {
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	if len(got) < len(unit) {
+		t.Fatalf("got %d stretched samples, want at least %d", len(got), len(unit))
+	}
+	for i, v := range unit {
+		if math.Abs(float64(got[i]-v)) > 1e-6 {
+			t.Fatalf("sample %d: got %v, want %v", i, got[i], v)
+		}
+	}
+
+	p = NewPaulstretchWithOptions(4, testWindowSize, WithOutputRange(0, 1))
+	got = stretchAll(t, p, samples, func(s []float32) error {
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	below := 0
+	for i, v := range got {
+		if v < 0 || v > 1 {
+			t.Fatalf("sample %d: got %v, want a sample in [0, 1]", i, v)
+		}
+		if v < 0.5 {
+			below++
+		}
+	}
+	if below == 0 || below == len(got) {
+		t.Errorf("got %d of %d samples below the center of the range, want some", below, len(got))
+	}
+
+	// samples outside of the input range are clamped
+	p = NewPaulstretchWithOptions(1, testWindowSize, WithInputRange(0, 1))
+	over := make([]float32, testWindowSize)
+	for i := range over {
+		over[i] = 3
+	}
+	got = stretchAll(t, p, over, func(s []float32) error {
+		_, err := p.WriteSamples(s)
+		return err
+	}, p.ReadSamples)
+	for i, v := range got[:len(over)] {
+		if v != 1 {
+			t.Fatalf("sample %d: got %v, want 1", i, v)
+		}
+	}
+}
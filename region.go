@@ -0,0 +1,161 @@
+package paulstretch
+
+import (
+	"errors"
+	"io"
+	"math"
+)
+
+// regionCrossfade is the length of the crossfades of StretchRegion at both ends of the stretched region,
+// in samples: about 11.6 ms at 44.1 kHz.
+const regionCrossfade = 512
+
+// StretchRegion is a utility function that stretches only a region of an audio sample stream (native-endian floats)
+// read from input, and writes the resulting audio sample stream to output: the samples before startSample are copied
+// as is, the samples from startSample to endSample (excluded) are stretched, and the samples from endSample are
+// copied as is, so that only the middle of the stream is stretched, as in an audio editor.
+//
+// stretchFactor and windowSize are the same as for NewPaulstretch. The stretched region is crossfaded with
+// the samples copied around it, over 512 samples (about 11.6 ms at 44.1 kHz) at each end, or fewer if there
+// are fewer samples, to avoid clicks at the seams: the stretched region overlaps the samples copied before
+// and after it by these samples, so that the output is shorter than the copied samples and the stretched region
+// together. The region ends early if input ends before endSample.
+//
+// StretchRegion returns the first error returned by input or output, or nil once all the audio is written to output.
+// It no longer reads input once it returns, even on an error: it then waits for a call to Read of input in progress
+// to return.
+func StretchRegion(input io.Reader, output io.Writer, startSample, endSample int64, stretchFactor float64, windowSize int) error {
+	if startSample < 0 || endSample < startSample {
+		return errors.New("paulstretch: invalid region")
+	}
+	before := int64(regionCrossfade)
+	if before > startSample {
+		before = startSample
+	}
+	if _, err := io.CopyN(output, input, (startSample-before)*4); err != nil {
+		if err == io.EOF {
+			// input ends before the region
+			return nil
+		}
+		return err
+	}
+	head, err := readRegionSamples(input, int(before))
+	if err != nil || int64(len(head)) < before {
+		if err == nil {
+			err = writeRegionSamples(output, head)
+		}
+		return err
+	}
+
+	p := NewPaulstretch(stretchFactor, windowSize)
+	ended := make(chan bool, 1)
+	stopped := false
+	defer func() {
+		if !stopped {
+			// on an error, stop the goroutine, whose Write then returns ErrClosed, and wait until it no longer
+			// reads input
+			p.Close()
+			<-ended
+		}
+	}()
+	go func() {
+		_, err := io.CopyN(p, input, (endSample-startSample)*4)
+		if err != nil && err != io.EOF {
+			p.CloseWithError(err)
+			ended <- true
+			return
+		}
+		p.CloseFlush()
+		ended <- err == io.EOF
+	}()
+	// the last stretched samples are held back for the crossfade with the samples after the region
+	stretched := make([]float32, 0, p.OptimalBufferSize()+2*regionCrossfade)
+	buf := make([]float32, p.OptimalBufferSize())
+	started := false
+	for {
+		n, err := p.ReadSamples(buf)
+		stretched = append(stretched, buf[:n]...)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if !started && (len(stretched) >= len(head)+regionCrossfade || err == io.EOF) {
+			started = true
+			if stretched, err = crossfadeRegion(output, head, stretched, err); err != nil && err != io.EOF {
+				return err
+			}
+		}
+		if started && len(stretched) > regionCrossfade {
+			if err := writeRegionSamples(output, stretched[:len(stretched)-regionCrossfade]); err != nil {
+				return err
+			}
+			stretched = stretched[:copy(stretched, stretched[len(stretched)-regionCrossfade:])]
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	stopped = true
+	if <-ended {
+		return writeRegionSamples(output, stretched)
+	}
+	tail, err := readRegionSamples(input, regionCrossfade)
+	if err != nil {
+		return err
+	}
+	tail, err = crossfadeRegion(output, stretched, tail, nil)
+	if err == nil {
+		err = writeRegionSamples(output, tail)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, input)
+	return err
+}
+
+// crossfadeRegion writes the samples of a, and the samples of b crossfaded with the end of a, over as many samples
+// as both have, up to regionCrossfade. It returns the rest of b, not written yet, and readErr, or the error of output.
+func crossfadeRegion(output io.Writer, a []float32, b []float32, readErr error) ([]float32, error) {
+	n := regionCrossfade
+	if n > len(a) {
+		n = len(a)
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	mixed := append([]float32(nil), a...)
+	end := mixed[len(mixed)-n:]
+	for i := range end {
+		// equal-power crossfade, since the stretched audio is not correlated with the samples around it
+		t := float64(i+1) / float64(n+1) * math.Pi / 2
+		end[i] = float32(math.Cos(t))*end[i] + float32(math.Sin(t))*b[i]
+	}
+	if err := writeRegionSamples(output, mixed); err != nil {
+		return nil, err
+	}
+	return b[:copy(b, b[n:])], readErr
+}
+
+// readRegionSamples reads up to n samples from r, fewer if r ends before.
+func readRegionSamples(r io.Reader, n int) ([]float32, error) {
+	buf := make([]byte, n*4)
+	k, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	samples := make([]float32, k/4)
+	for i := range samples {
+		samples[i] = math.Float32frombits(nativeOrder.Uint32(buf[i*4:]))
+	}
+	return samples, err
+}
+
+// writeRegionSamples writes samples to w.
+func writeRegionSamples(w io.Writer, samples []float32) error {
+	buf := make([]byte, len(samples)*4)
+	for i, v := range samples {
+		nativeOrder.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	_, err := w.Write(buf)
+	return err
+}
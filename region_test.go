@@ -0,0 +1,95 @@
+package paulstretch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+	"unsafe"
+)
+
+func TestStretchRegion(t *testing.T) {
+	samples := testSamples(20 * testWindowSize)
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	const start, end = 5 * testWindowSize, 9 * testWindowSize
+	stretched := NewPaulstretch(2, testWindowSize).EstimateOutputSamples(end - start)
+
+	var out bytes.Buffer
+	if err := StretchRegion(bytes.NewReader(input), &out, start, end, 2, testWindowSize); err != nil {
+		t.Fatalf("StretchRegion: %v", err)
+	}
+	got := decodeSamples(out.Bytes())
+	if want := int(start + stretched + int64(len(samples)) - end - 2*regionCrossfade); len(got) != want {
+		t.Fatalf("StretchRegion: got %d samples, want %d", len(got), want)
+	}
+	// the samples around the region and its crossfades are copied as is
+	for i := 0; i < start-regionCrossfade; i++ {
+		if got[i] != samples[i] {
+			t.Fatalf("StretchRegion: got sample %v at %d, want %v", got[i], i, samples[i])
+		}
+	}
+	after := samples[end+regionCrossfade:]
+	for i, v := range got[len(got)-len(after):] {
+		if v != after[i] {
+			t.Fatalf("StretchRegion: got sample %v at %d from the end, want %v", v, len(after)-i, after[i])
+		}
+	}
+
+	// a region past the end of the input leaves the input as is
+	out.Reset()
+	if err := StretchRegion(bytes.NewReader(input), &out, int64(len(samples)), int64(len(samples))+10, 2, testWindowSize); err != nil || !bytes.Equal(out.Bytes(), input) {
+		t.Errorf("StretchRegion past the end: got (%d bytes, %v), want (%d bytes, nil)", out.Len(), err, len(input))
+	}
+
+	errInput := errors.New("input error")
+	in := io.MultiReader(bytes.NewReader(input[:(start+10)*4]), iotest.ErrReader(errInput))
+	if err := StretchRegion(in, io.Discard, start, end, 2, testWindowSize); err != errInput {
+		t.Errorf("StretchRegion with an input error: got error %v, want %v", err, errInput)
+	}
+	errOutput := errors.New("output error")
+	if err := StretchRegion(bytes.NewReader(input), &errWriter{n: (start + 10) * 4, err: errOutput}, start, end, 2, testWindowSize); err != errOutput {
+		t.Errorf("StretchRegion with an output error: got error %v, want %v", err, errOutput)
+	}
+	if err := StretchRegion(bytes.NewReader(input), io.Discard, end, start, 2, testWindowSize); err == nil {
+		t.Error("StretchRegion with an invalid region: got no error")
+	}
+}
+
+// decodeSamples returns the native-endian float samples of data.
+func decodeSamples(data []byte) []float32 {
+	samples := make([]float32, len(data)/4)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4), data)
+	return samples
+}
+
+// slowReader is an endless, slow reader of silence, recording whether a call to Read is in progress.
+type slowReader struct {
+	reading int32
+}
+
+func (r *slowReader) Read(data []byte) (int, error) {
+	atomic.StoreInt32(&r.reading, 1)
+	defer atomic.StoreInt32(&r.reading, 0)
+	time.Sleep(time.Millisecond)
+	if len(data) > 64 {
+		data = data[:64]
+	}
+	for i := range data {
+		data[i] = 0
+	}
+	return len(data), nil
+}
+
+func TestStretchRegionError(t *testing.T) {
+	input := &slowReader{}
+	errOutput := errors.New("output error")
+	if err := StretchRegion(input, &errWriter{n: 0, err: errOutput}, 0, 1<<30, 2, testWindowSize); err != errOutput {
+		t.Fatalf("got error %v, want %v", err, errOutput)
+	}
+	if atomic.LoadInt32(&input.reading) != 0 {
+		t.Error("input still read after StretchRegion returned")
+	}
+}
@@ -0,0 +1,303 @@
+package paulstretch
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// maxRemoteBlock is the maximum number of samples of a block of the protocol of ServeStretch, so that a corrupt
+// length does not allocate an arbitrary amount of memory.
+const maxRemoteBlock = 1 << 20
+
+// errRemoteBlock is returned by ServeStretch and RemoteStretch when a block is larger than maxRemoteBlock.
+var errRemoteBlock = errors.New("paulstretch: remote block too large")
+
+// ServeStretch stretches the audio streamed over conn, for example a connection accepted by a worker
+// serving thin clients using DialStretch: it reads samples from conn, stretches them with the stretch factor
+// and window size of NewPaulstretch, and writes the stretched samples back to conn, then closes conn.
+//
+// The protocol is the same in both directions: a stream of blocks, each a little-endian uint32 number of samples,
+// followed by the samples, as little-endian 32-bit floats. A block of 0 samples ends the stream: the client sends it
+// once all its samples are sent, and the server flushes them, as with CloseFlush, and writes the rest of the stretched
+// audio, then a block of 0 samples. Blocks may have any number of samples, up to 2^20: RemoteStretch splits
+// the samples written into blocks of at most 2^20 samples.
+//
+// ServeStretch returns once the stretched audio is written, or at the first error, for example if the client
+// closes conn before ending its stream. It returns nil once the stream is ended and its stretched audio written.
+func ServeStretch(conn io.ReadWriteCloser, factor float64, windowSize int) error {
+	defer conn.Close()
+	p := NewPaulstretch(factor, windowSize)
+	defer p.ReleaseBuffers()
+	errCh := make(chan error, 1)
+	go func() {
+		err := serveInput(conn, p)
+		if err == nil {
+			err = p.CloseFlush()
+		} else {
+			p.CloseWithError(err)
+		}
+		errCh <- err
+	}()
+	err := serveOutput(conn, p)
+	// unblock the input, if the output failed
+	p.Close()
+	if err != nil {
+		conn.Close()
+	}
+	if inErr := <-errCh; err == nil {
+		err = inErr
+	}
+	return err
+}
+
+// serveInput writes the samples of the blocks read from r to p, until the block ending the stream.
+func serveInput(r io.Reader, p *Paulstretch) error {
+	var buf []byte
+	var samples []float32
+	for {
+		var err error
+		samples, buf, err = readBlock(r, samples, buf)
+		if err != nil {
+			return err
+		}
+		if len(samples) == 0 {
+			return nil
+		}
+		if _, err := p.WriteSamples(samples); err != nil {
+			return err
+		}
+	}
+}
+
+// serveOutput writes the stretched samples read from p to w, in blocks, then the block ending the stream.
+func serveOutput(w io.Writer, p *Paulstretch) error {
+	samples := make([]float32, p.OptimalBufferSize())
+	var buf []byte
+	for {
+		n, err := p.ReadSamples(samples)
+		if n > 0 {
+			if _, buf, err = writeBlocks(w, samples[:n], buf); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			_, err = writeBlock(w, nil, buf)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeBlock writes a block of samples, using buf as a buffer, and returns it for the next call.
+func writeBlock(w io.Writer, samples []float32, buf []byte) ([]byte, error) {
+	if size := 4 + len(samples)*4; cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:4+len(samples)*4]
+	binary.LittleEndian.PutUint32(buf, uint32(len(samples)))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint32(buf[4+i*4:], math.Float32bits(v))
+	}
+	_, err := w.Write(buf)
+	return buf, err
+}
+
+// writeBlocks writes samples in blocks of at most maxRemoteBlock samples, using buf as a buffer, and returns
+// the number of samples of the blocks written, and buf for the next call.
+func writeBlocks(w io.Writer, samples []float32, buf []byte) (int, []byte, error) {
+	n := 0
+	for n < len(samples) {
+		block := samples[n:]
+		if len(block) > maxRemoteBlock {
+			block = block[:maxRemoteBlock]
+		}
+		var err error
+		if buf, err = writeBlock(w, block, buf); err != nil {
+			return n, buf, err
+		}
+		n += len(block)
+	}
+	return n, buf, nil
+}
+
+// readBlock reads a block of samples into samples, using buf as a buffer, and returns them for the next call.
+// An incomplete block is an io.ErrUnexpectedEOF.
+func readBlock(r io.Reader, samples []float32, buf []byte) ([]float32, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return samples[:0], buf, err
+	}
+	n := int(binary.LittleEndian.Uint32(header[:]))
+	if n > maxRemoteBlock {
+		return samples[:0], buf, errRemoteBlock
+	}
+	if cap(buf) < n*4 {
+		buf = make([]byte, n*4)
+	}
+	buf = buf[:n*4]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return samples[:0], buf, err
+	}
+	if cap(samples) < n {
+		samples = make([]float32, n)
+	}
+	samples = samples[:n]
+	for i := range samples {
+		samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return samples, buf, nil
+}
+
+// RemoteStretch is the client end of a stretch served by ServeStretch over a connection, returned by DialStretch,
+// which is used like a Paulstretch: Write writes audio to be stretched, and Read reads the stretched audio.
+//
+// Write and Read can be called concurrently, and must be, as with Paulstretch, unless the connection buffers
+// all the audio: the server stops reading audio until its stretched audio is read.
+type RemoteStretch struct {
+	conn io.ReadWriteCloser
+
+	writeMu   sync.Mutex
+	partial   []byte // bytes of an incomplete sample written
+	samples   []float32
+	writeBuf  []byte
+	closeOnce sync.Once
+
+	readMu   sync.Mutex
+	pending  []byte // bytes of the stretched samples read and not yet returned
+	blockBuf []byte
+	block    []float32
+	readBuf  []byte
+	readErr  error // error returned by Read once pending is empty, io.EOF at the end of the stream
+}
+
+// DialStretch returns the client end of a stretch served by ServeStretch over conn, for example a connection
+// to a worker stretching audio for thin clients. The stretch factor and window size are those of the server.
+func DialStretch(conn io.ReadWriteCloser) *RemoteStretch {
+	return &RemoteStretch{conn: conn, partial: make([]byte, 0, 4)}
+}
+
+// Write writes bytes of an audio sample stream (native-endian floats) to be stretched by the server, in blocks
+// of the samples they complete. The bytes of a sample can be split across several calls to Write.
+//
+// If a block cannot be sent, Write returns the number of bytes of data of the samples sent before, and the bytes
+// of data after them are not written: the caller can write them again.
+func (r *RemoteStretch) Write(data []byte) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.samples = r.samples[:0]
+	prev := len(r.partial) // bytes of an incomplete sample of previous calls
+	c := 0
+	if prev > 0 {
+		c = copy(r.partial[prev:4], data)
+		r.partial = r.partial[:prev+c]
+		if len(r.partial) < 4 {
+			return len(data), nil
+		}
+		r.samples = append(r.samples, math.Float32frombits(nativeOrder.Uint32(r.partial)))
+	}
+	whole := c + (len(data)-c)&^3
+	for i := c; i < whole; i += 4 {
+		r.samples = append(r.samples, math.Float32frombits(nativeOrder.Uint32(data[i:])))
+	}
+	sent, buf, err := writeBlocks(r.conn, r.samples, r.writeBuf)
+	r.writeBuf = buf
+	if err != nil {
+		if prev > 0 && sent == 0 {
+			// the incomplete sample of previous calls is kept, without the bytes of data
+			r.partial = r.partial[:prev]
+			return 0, err
+		}
+		r.partial = r.partial[:0]
+		// the first sample sent can start with bytes of previous calls
+		return sent*4 - prev, err
+	}
+	r.partial = append(r.partial[:0], data[whole:]...)
+	return len(data), nil
+}
+
+// WriteSamples writes samples to be stretched by the server, in blocks, and returns the number of samples sent.
+func (r *RemoteStretch) WriteSamples(samples []float32) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	sent, buf, err := writeBlocks(r.conn, samples, r.writeBuf)
+	r.writeBuf = buf
+	return sent, err
+}
+
+// CloseFlush ends the stream of audio written, as with Paulstretch.CloseFlush: the server stretches the rest
+// of the audio, and Read returns the rest of the stretched audio, then EOF. The bytes of a last, incomplete
+// sample are discarded. Calling CloseFlush again does nothing.
+func (r *RemoteStretch) CloseFlush() error {
+	var err error
+	r.closeOnce.Do(func() {
+		r.writeMu.Lock()
+		defer r.writeMu.Unlock()
+		r.partial = r.partial[:0]
+		_, err = writeBlock(r.conn, nil, r.writeBuf)
+	})
+	return err
+}
+
+// Read reads bytes of the stretched audio sample stream (native-endian floats) sent by the server.
+// Like Paulstretch.Read, Read returns EOF once all the stretched audio was read, after CloseFlush.
+func (r *RemoteStretch) Read(data []byte) (int, error) {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+	if len(data) == 0 {
+		return 0, nil
+	}
+	for len(r.pending) == 0 {
+		if r.readErr != nil {
+			return 0, r.readErr
+		}
+		var err error
+		r.block, r.blockBuf, err = readBlock(r.conn, r.block, r.blockBuf)
+		if err != nil {
+			r.readErr = err
+			continue
+		}
+		if len(r.block) == 0 {
+			r.readErr = io.EOF
+			continue
+		}
+		if cap(r.readBuf) < len(r.block)*4 {
+			r.readBuf = make([]byte, len(r.block)*4)
+		}
+		r.pending = r.readBuf[:len(r.block)*4]
+		for i, v := range r.block {
+			nativeOrder.PutUint32(r.pending[i*4:], math.Float32bits(v))
+		}
+	}
+	n := copy(data, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// ReadSamples reads stretched samples sent by the server, and returns the number of samples read.
+func (r *RemoteStretch) ReadSamples(samples []float32) (int, error) {
+	if len(samples) == 0 {
+		return 0, nil
+	}
+	n, err := r.Read(unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4))
+	runtime.KeepAlive(samples)
+	return n / 4, err
+}
+
+// Close closes the connection, abandoning the stretch: the server then stops, and returns an error unless
+// the stream was ended with CloseFlush and all its stretched audio was sent.
+func (r *RemoteStretch) Close() error {
+	return r.conn.Close()
+}
@@ -0,0 +1,160 @@
+package paulstretch
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestServeStretch(t *testing.T) {
+	for _, factor := range []float64{1, 2} {
+		samples := testSamples(3*testWindowSize + 7)
+		ref := NewPaulstretch(factor, testWindowSize)
+		want := stretchAll(t, ref, samples, func(s []float32) error {
+			_, err := ref.WriteSamples(s)
+			return err
+		}, ref.ReadSamples)
+
+		client, server := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- ServeStretch(server, factor, testWindowSize)
+		}()
+		r := DialStretch(client)
+		written := make(chan error, 1)
+		go func() {
+			written <- func() error {
+				b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+				// chunks not aligned on samples
+				for len(b) > 0 {
+					c := 4*37 + 2
+					if c > len(b) {
+						c = len(b)
+					}
+					if _, err := r.Write(b[:c]); err != nil {
+						return err
+					}
+					b = b[c:]
+				}
+				return r.CloseFlush()
+			}()
+		}()
+		var got []float32
+		buf := make([]float32, 100)
+		for {
+			n, err := r.ReadSamples(buf)
+			got = append(got, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("factor %v: ReadSamples: %v", factor, err)
+			}
+		}
+		if err := <-written; err != nil {
+			t.Fatalf("factor %v: write: %v", factor, err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("factor %v: ServeStretch: %v", factor, err)
+		}
+		r.Close()
+		if len(got) != len(want) {
+			t.Errorf("factor %v: got %d stretched samples, want %d", factor, len(got), len(want))
+		} else if factor == 1 && !reflect.DeepEqual(got, want) {
+			t.Errorf("factor %v: got stretched samples different from those of a local Paulstretch", factor)
+		}
+	}
+}
+
+func TestServeStretchClose(t *testing.T) {
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeStretch(server, 2, testWindowSize)
+	}()
+	r := DialStretch(client)
+	if _, err := r.WriteSamples(testSamples(10)); err != nil {
+		t.Fatalf("WriteSamples: %v", err)
+	}
+	r.Close()
+	if err := <-done; err == nil {
+		t.Error("ServeStretch: got no error after the client closed its connection without ending its stream")
+	}
+}
+
+func TestRemoteStretchLargeWrite(t *testing.T) {
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeStretch(server, 1, testWindowSize)
+	}()
+	r := DialStretch(client)
+	defer r.Close()
+	// more than a block of samples, written at once
+	samples := testSamples(2*maxRemoteBlock + 3)
+	written := make(chan error, 1)
+	go func() {
+		n, err := r.WriteSamples(samples)
+		if err == nil && n != len(samples) {
+			t.Errorf("WriteSamples: got %d samples written, want %d", n, len(samples))
+		}
+		if err == nil {
+			err = r.CloseFlush()
+		}
+		written <- err
+	}()
+	got := 0
+	buf := make([]float32, 4096)
+	for {
+		n, err := r.ReadSamples(buf)
+		got += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadSamples: %v", err)
+		}
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("ServeStretch: %v", err)
+	}
+	if want := NewPaulstretch(1, testWindowSize).EstimateOutputSamples(int64(len(samples))); int64(got) != want {
+		t.Errorf("got %d stretched samples, want %d", got, want)
+	}
+}
+
+// failingConn is a connection whose writes fail after a number of successful writes.
+type failingConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if c.writes == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	c.writes--
+	return len(b), nil
+}
+
+func TestRemoteStretchWriteError(t *testing.T) {
+	// the first Write and the first block of the second are sent, the next block fails
+	r := DialStretch(&failingConn{writes: 2})
+	samples := testSamples(maxRemoteBlock + 10)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	if n, err := r.Write(b[:5]); n != 5 || err != nil {
+		t.Fatalf("Write: got (%d, %v), want (5, nil)", n, err)
+	}
+	// the sample started by the previous call is the first sample sent
+	if n, err := r.Write(b[5:]); n != maxRemoteBlock*4-1 || err != io.ErrClosedPipe {
+		t.Errorf("Write: got (%d, %v), want (%d, %v)", n, err, maxRemoteBlock*4-1, io.ErrClosedPipe)
+	}
+	if n, err := r.WriteSamples(samples); n != 0 || err != io.ErrClosedPipe {
+		t.Errorf("WriteSamples: got (%d, %v), want (0, %v)", n, err, io.ErrClosedPipe)
+	}
+}
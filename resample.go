@@ -0,0 +1,123 @@
+package paulstretch
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// resampler is a streaming resampler of interleaved frames, using cubic (Catmull-Rom) interpolation.
+type resampler struct {
+	channels int
+	step     float64   // input frames per output frame
+	pos      float64   // position in buf of the next output frame
+	buf      []float32 // input frames not yet fully used for interpolation
+}
+
+// newResampler returns a resampler of frames of channels samples, producing one output frame
+// every step input frames.
+func newResampler(channels int, step float64) *resampler {
+	return &resampler{
+		channels: channels,
+		step:     step,
+		pos:      1,
+		// start with a frame of silence, so that the first input frame can be interpolated
+		buf: make([]float32, channels),
+	}
+}
+
+// process resamples the input frames in, appends the resampled frames to out, and returns it.
+//
+// The resampler keeps the last few input frames, needed to interpolate the next output frames,
+// until the next call.
+func (r *resampler) process(in []float32, out []float32) []float32 {
+	ch := r.channels
+	r.buf = append(r.buf, in...)
+	frames := len(r.buf) / ch
+	// interpolating at pos needs the frames from floor(pos)-1 to floor(pos)+2
+	for r.pos+2 < float64(frames) {
+		i := int(r.pos)
+		t := float32(r.pos - float64(i))
+		for c := 0; c < ch; c++ {
+			y0 := r.buf[(i-1)*ch+c]
+			y1 := r.buf[i*ch+c]
+			y2 := r.buf[(i+1)*ch+c]
+			y3 := r.buf[(i+2)*ch+c]
+			out = append(out, y1+0.5*t*(y2-y0+t*(2*y0-5*y1+4*y2-y3+t*(3*(y1-y2)+y3-y0))))
+		}
+		r.pos += r.step
+	}
+	if drop := int(r.pos) - 1; drop > 0 {
+		if drop > frames {
+			drop = frames
+		}
+		r.buf = r.buf[:copy(r.buf, r.buf[drop*ch:])]
+		r.pos -= float64(drop)
+	}
+	return out
+}
+
+// convertsInput returns whether the written samples are converted, by writeResampled, before they are written.
+func (p *Paulstretch) convertsInput() bool {
+	return p.inResampler != nil || p.downmix != 0
+}
+
+// writeResampled downmixes data to mono with WithDownmixToMono, and resamples it with inResampler, writes
+// the converted samples, and returns the number of bytes of data consumed, which is all of data, unless
+// converted samples left by a previous error could not be written.
+//
+// If the resampled samples cannot all be written, they are kept in resampled for the next Write or Flush.
+func (p *Paulstretch) writeResampled(data []byte) (int, error) {
+	if len(p.resampled) > 0 {
+		if err := p.writePending(); err != nil {
+			return 0, err
+		}
+	}
+	frame := 4 * p.channels
+	if p.downmix != 0 {
+		frame = 4 * p.downmix
+	}
+	p.resampleIn = append(p.resampleIn, data...)
+	whole := len(p.resampleIn) / frame * frame
+	in := p.resampleBuf[:0]
+	for i := 0; i < whole; i += 4 {
+		in = append(in, math.Float32frombits(p.byteOrder.Uint32(p.resampleIn[i:])))
+	}
+	p.resampleIn = p.resampleIn[:copy(p.resampleIn, p.resampleIn[whole:])]
+	if p.downmix != 0 {
+		in = downmix(in, p.downmix)
+	}
+	out := in
+	if p.inResampler != nil {
+		out = p.inResampler.process(in, in[len(in):])
+	}
+	if cap(p.resampled) < len(out)*4 {
+		p.resampled = make([]byte, 0, len(out)*4)
+	}
+	p.resampled = p.resampled[:len(out)*4]
+	for i, v := range out {
+		p.byteOrder.PutUint32(p.resampled[i*4:], math.Float32bits(v))
+	}
+	p.resampleBuf = in[:0]
+	atomic.AddInt64(&p.stats.bytesWritten, int64(len(data)))
+	return len(data), p.writePending()
+}
+
+// downmix averages the frames of channels samples of in to mono samples, in place, and returns them.
+func downmix(in []float32, channels int) []float32 {
+	out := in[:0]
+	for i := 0; i+channels <= len(in); i += channels {
+		var sum float64
+		for _, v := range in[i : i+channels] {
+			sum += float64(v)
+		}
+		out = append(out, float32(sum/float64(channels)))
+	}
+	return out
+}
+
+// writePending writes the resampled samples not yet written, keeping those that cannot be written on error.
+func (p *Paulstretch) writePending() error {
+	n, err := p.write(p.resampled)
+	p.resampled = p.resampled[:copy(p.resampled, p.resampled[n:])]
+	return err
+}
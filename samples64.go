@@ -0,0 +1,35 @@
+package paulstretch
+
+// WriteSamples64 is like WriteSamples, for samples in double precision.
+//
+// Paulstretch processes audio in single precision, like libpaulstretch: WriteSamples64 only converts the samples
+// to float32 before writing them, and its result is the same as writing the converted samples with WriteSamples.
+// The conversion error does not accumulate over long streams, since each sample is converted independently.
+func (p *Paulstretch) WriteSamples64(samples []float64) (int, error) {
+	if cap(p.writeConv) < len(samples) {
+		p.writeConv = make([]float32, len(samples))
+	}
+	p.writeConv = p.writeConv[:len(samples)]
+	for i, v := range samples {
+		p.writeConv[i] = float32(v)
+	}
+	return p.WriteSamples(p.writeConv)
+}
+
+// ReadSamples64 is like ReadSamples, for samples in double precision.
+//
+// Paulstretch processes audio in single precision, like libpaulstretch: ReadSamples64 only converts
+// the samples read with ReadSamples to float64.
+func (p *Paulstretch) ReadSamples64(samples []float64) (int, error) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	if cap(p.readConv) < len(samples) {
+		p.readConv = make([]float32, len(samples))
+	}
+	p.readConv = p.readConv[:len(samples)]
+	n, err := p.readSamples(p.readConv)
+	for i, v := range p.readConv[:n] {
+		samples[i] = float64(v)
+	}
+	return n, err
+}
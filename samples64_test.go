@@ -0,0 +1,85 @@
+package paulstretch
+
+import (
+	"io"
+	"math"
+	"testing"
+)
+
+// TestSamples64 stretches a long DC signal with WriteSamples64 and ReadSamples64, and checks that the conversion
+// error is the same as with the float32 path, and does not accumulate over the stream.
+func TestSamples64(t *testing.T) {
+	const dc = 0.1
+	samples := make([]float64, 200*testWindowSize)
+	for i := range samples {
+		samples[i] = dc
+	}
+	samples32 := make([]float32, len(samples))
+	for i, v := range samples {
+		samples32[i] = float32(v)
+	}
+
+	ref := NewPaulstretch(1, testWindowSize)
+	p := NewPaulstretch(1, testWindowSize)
+	// compare the outputs of engines without random phases
+	for _, p := range []*Paulstretch{p, ref} {
+		p.ps[0].destroy()
+		p.ps[0] = &identityEngine{}
+	}
+	want := stretchAll(t, ref, samples32, func(s []float32) error {
+		_, err := ref.WriteSamples(s)
+		return err
+	}, ref.ReadSamples)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.WriteSamples64(samples)
+		if err == nil {
+			err = p.Flush()
+		}
+		p.Close()
+		done <- err
+	}()
+	got, err := readAll64(p)
+	if err != nil {
+		t.Fatalf("ReadSamples64: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("WriteSamples64: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("ReadSamples64: got %d samples, want %d", len(got), len(want))
+	}
+	maxErr := math.Abs(float64(float32(dc)) - dc)
+	signal := 0
+	for i, v := range got {
+		if v != float64(want[i]) {
+			t.Fatalf("ReadSamples64: sample %d: got %v, want %v", i, v, want[i])
+		}
+		if d := math.Abs(v - dc); v != 0 && d > maxErr {
+			t.Fatalf("ReadSamples64: sample %d: error %g, want at most %g", i, d, maxErr)
+		}
+		if v != 0 {
+			signal++
+		}
+	}
+	if signal < len(samples) {
+		t.Errorf("ReadSamples64: got %d samples of signal, want at least %d", signal, len(samples))
+	}
+}
+
+func readAll64(p *Paulstretch) ([]float64, error) {
+	var out []float64
+	buf := make([]float64, 100)
+	for {
+		n, err := p.ReadSamples64(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
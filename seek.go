@@ -0,0 +1,180 @@
+package paulstretch
+
+import (
+	"errors"
+	"io"
+)
+
+// SeekablePaulstretch stretches an audio sample stream (native-endian floats, unless WithByteOrder is used)
+// read from an io.ReadSeeker, and supports the Reader, Seeker and Closer interfaces for the stretched audio
+// sample stream.
+//
+// To create a SeekablePaulstretch, use NewSeekablePaulstretch.
+//
+// Seeking is implemented by stretching the input again from its start, and discarding the stretched audio
+// up to the requested offset: seeking forward costs as much as stretching the audio in between, and seeking
+// backward costs as much as stretching all the audio up to the requested offset.
+// Because libpaulstretch randomizes the phases of the stretched audio, the stretched audio read after a seek
+// is not identical to the stretched audio read at the same offset before it, although it sounds the same.
+type SeekablePaulstretch struct {
+	input         io.ReadSeeker
+	stretchFactor float64
+	windowSize    int
+	opts          []Option
+
+	p      *Paulstretch
+	done   chan error // receives the result of feeding p from input
+	err    error
+	pos    int64
+	closed bool // Close was called
+}
+
+// NewSeekablePaulstretch returns a SeekablePaulstretch stretching the audio read from input.
+//
+// stretchFactor, windowSize and opts are the same as for NewPaulstretchWithOptions. input is read from
+// its current offset, which is considered to be the start of the audio. The end of the input is
+// flushed, as with Flush.
+func NewSeekablePaulstretch(input io.ReadSeeker, stretchFactor float64, windowSize int, opts ...Option) (*SeekablePaulstretch, error) {
+	start, err := input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	s := &SeekablePaulstretch{
+		input:         &offsetReadSeeker{r: input, start: start},
+		stretchFactor: stretchFactor,
+		windowSize:    windowSize,
+		opts:          opts,
+	}
+	s.start()
+	return s, nil
+}
+
+// start starts stretching the input from its current offset.
+func (s *SeekablePaulstretch) start() {
+	p := NewPaulstretchWithOptions(s.stretchFactor, s.windowSize, s.opts...)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(p, s.input)
+		if err == nil {
+			err = p.Flush()
+		}
+		p.Close()
+		if err == ErrClosed {
+			// p was closed by Seek or Close
+			err = nil
+		}
+		done <- err
+	}()
+	s.p = p
+	s.done = done
+	s.err = nil
+	s.pos = 0
+}
+
+// stop stops stretching the input, and waits until the input is no longer read.
+func (s *SeekablePaulstretch) stop() error {
+	s.p.Close()
+	err := <-s.done
+	s.done = nil
+	s.p.ReleaseBuffers()
+	return err
+}
+
+// Read reads bytes of the stretched audio sample stream.
+//
+// Read returns any error encountered while reading the input once all stretched audio is read, or EOF.
+// Read returns ErrClosed once SeekablePaulstretch is closed.
+func (s *SeekablePaulstretch) Read(data []byte) (int, error) {
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if s.done == nil {
+		if s.err != nil {
+			return 0, s.err
+		}
+		return 0, io.EOF
+	}
+	n, err := s.p.Read(data)
+	s.pos += int64(n)
+	if err == io.EOF {
+		if s.err = <-s.done; s.err != nil {
+			err = s.err
+		}
+		s.done = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset, in bytes, for the next Read of the stretched audio sample stream.
+//
+// Seeking relative to the end (io.SeekEnd) is not supported, since the length of the stretched audio is only
+// known once it is completely stretched. Seek returns ErrClosed once SeekablePaulstretch is closed, and any error
+// encountered while reading the input, when seeking backward stops the stretching in progress.
+func (s *SeekablePaulstretch) Seek(offset int64, whence int) (int64, error) {
+	if s.closed {
+		return 0, ErrClosed
+	}
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = s.pos + offset
+	case io.SeekEnd:
+		return 0, errors.New("paulstretch: seeking relative to the end is not supported")
+	default:
+		return 0, errors.New("paulstretch: invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("paulstretch: negative position")
+	}
+	if target < s.pos || s.done == nil {
+		if s.done != nil {
+			if err := s.stop(); err != nil {
+				// stretch again from the start on the next Seek
+				s.err = err
+				return s.pos, err
+			}
+		}
+		if _, err := s.input.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		s.start()
+	}
+	if target > s.pos {
+		if _, err := io.CopyN(io.Discard, s, target-s.pos); err != nil && err != io.EOF {
+			return s.pos, err
+		}
+	}
+	return s.pos, nil
+}
+
+// Close stops stretching the audio. Close does not close the input. Calling Close again does nothing.
+func (s *SeekablePaulstretch) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.done == nil {
+		return nil
+	}
+	return s.stop()
+}
+
+// offsetReadSeeker is an io.ReadSeeker whose offsets are relative to a start offset of an underlying io.ReadSeeker.
+type offsetReadSeeker struct {
+	r     io.ReadSeeker
+	start int64
+}
+
+func (o *offsetReadSeeker) Read(data []byte) (int, error) {
+	return o.r.Read(data)
+}
+
+func (o *offsetReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		offset += o.start
+	}
+	n, err := o.r.Seek(offset, whence)
+	return n - o.start, err
+}
@@ -0,0 +1,84 @@
+package paulstretch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"unsafe"
+)
+
+func TestSeekablePaulstretch(t *testing.T) {
+	samples := testSamples(20*testWindowSize + 7)
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	s, err := NewSeekablePaulstretch(bytes.NewReader(input), 2, testWindowSize, WithChannels(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	buf := make([]byte, 1000)
+	if _, err := io.ReadFull(s, buf); err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := s.Seek(4000, io.SeekStart); pos != 4000 || err != nil {
+		t.Fatalf("Seek forward: got (%d, %v), want (4000, nil)", pos, err)
+	}
+	if pos, err := s.Seek(-3000, io.SeekCurrent); pos != 1000 || err != nil {
+		t.Fatalf("Seek backward: got (%d, %v), want (1000, nil)", pos, err)
+	}
+	rest, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := s.Seek(0, io.SeekStart); pos != 0 || err != nil {
+		t.Fatalf("Seek to start: got (%d, %v), want (0, nil)", pos, err)
+	}
+	all, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(rest)+1000 {
+		t.Errorf("stretched audio length after seeking: got %d, want %d", len(rest)+1000, len(all))
+	}
+}
+
+// failingReadSeeker is an io.ReadSeeker returning an error once its data is read.
+type failingReadSeeker struct {
+	*bytes.Reader
+	err error
+}
+
+func (r failingReadSeeker) Read(data []byte) (int, error) {
+	n, err := r.Reader.Read(data)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func TestSeekablePaulstretchErrors(t *testing.T) {
+	errInput := errors.New("input error")
+	samples := testSamples(testWindowSize)
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	s, err := NewSeekablePaulstretch(failingReadSeeker{bytes.NewReader(input), errInput}, 1, testWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if _, err := io.ReadFull(s, buf); err != nil {
+		t.Fatal(err)
+	}
+	// seeking backward stops the stretching, which failed to read the input
+	if _, err := s.Seek(0, io.SeekStart); err != errInput {
+		t.Errorf("Seek backward: got error %v, want %v", err, errInput)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := s.Seek(0, io.SeekStart); err != ErrClosed {
+		t.Errorf("Seek after Close: got error %v, want %v", err, ErrClosed)
+	}
+	if _, err := s.Read(buf); err != ErrClosed {
+		t.Errorf("Read after Close: got error %v, want %v", err, ErrClosed)
+	}
+}
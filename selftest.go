@@ -0,0 +1,72 @@
+package paulstretch
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// selfTestWindowSize and selfTestFactor are the window size and stretch factor of the instance of SelfTest.
+const (
+	selfTestWindowSize = 1024
+	selfTestFactor     = 4
+)
+
+// SelfTest stretches a known signal with a small instance of Paulstretch, and checks the stretched audio, to detect
+// a linked libpaulstretch that misbehaves, for example because of an ABI mismatch between the bindings and the
+// installed library, which could otherwise silently corrupt the stretched audio. Services can call it at startup
+// to fail fast.
+//
+// The signal is an impulse, in the middle of 4 windows of 1024 samples of silence, stretched by 4. SelfTest checks
+// that the stretched audio has the expected length to within a window, that its samples are finite and within
+// [-1, 1], and that its energy is that of the impulse times the stretch factor, to within a factor of 8, since
+// Paulstretch keeps the level of the audio. The stretched audio is random, and is not compared to a reference.
+// SelfTest takes about a millisecond of CPU on a typical machine, and allocates about 100 KB.
+//
+// SelfTest returns nil if the stretched audio passes the checks, or an error describing the first failed check.
+func SelfTest() error {
+	input := make([]float32, 4*selfTestWindowSize)
+	input[len(input)/2] = 1
+	p := NewPaulstretch(selfTestFactor, selfTestWindowSize)
+	defer p.ReleaseBuffers()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := p.WriteSamples(input)
+		if err == nil {
+			err = p.CloseFlush()
+		}
+		errCh <- err
+	}()
+	var out []float32
+	buf := make([]float32, p.OptimalBufferSize())
+	var err error
+	for err == nil {
+		var n int
+		n, err = p.ReadSamples(buf)
+		out = append(out, buf[:n]...)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	if writeErr := <-errCh; err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("paulstretch: self-test: %w", err)
+	}
+	want := p.EstimateOutputSamples(int64(len(input)))
+	if d := int64(len(out)) - want; d < -selfTestWindowSize || d > selfTestWindowSize {
+		return fmt.Errorf("paulstretch: self-test: got %d stretched samples, want %d", len(out), want)
+	}
+	energy := 0.0
+	for i, v := range out {
+		if f := float64(v); math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) > 1 {
+			return fmt.Errorf("paulstretch: self-test: got invalid stretched sample %d: %v", i, v)
+		}
+		energy += float64(v) * float64(v)
+	}
+	if energy < selfTestFactor/8.0 || energy > selfTestFactor*8.0 {
+		return fmt.Errorf("paulstretch: self-test: got stretched audio of energy %v, want about %v", energy, selfTestFactor)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package paulstretch
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// SetSource sets a source of audio samples (native-endian floats, unless WithByteOrder is used), that Read pulls
+// the audio to stretch from, as needed, instead of waiting for it to be written from another goroutine.
+//
+// This lets the stretched audio be pulled from a single goroutine, as in pull-based or callback-driven audio engines.
+// Read reads windows of samples from source and stretches them until stretched audio is available. When source returns
+// EOF, the end of its audio is flushed, as with Flush, and Paulstretch is closed, so that Read returns EOF once all
+// stretched audio is read. If source returns another error, Paulstretch is closed too, and Read returns this error
+// instead of EOF.
+//
+// Once a source is set, Write and Flush return ErrSource. Samples already written but not yet stretched are stretched
+// before those of source. Read blocks while source blocks, regardless of the read deadline, and TryRead never
+// reads from source. SetSource must be called before Read, and a nil source is ignored.
+func (p *Paulstretch) SetSource(source io.Reader) {
+	if source == nil || !p.initialized() {
+		return
+	}
+	p.rwCond.L.Lock()
+	p.source = source
+	p.rwCond.L.Unlock()
+}
+
+// pull implements Read with a source, writing windows read from the source until stretched audio is available.
+func (p *Paulstretch) pull(data []byte) (int, error) {
+	for {
+		p.rwCond.L.Lock()
+		if p.available() {
+			if n := p.emit(data); n > 0 {
+				return n, nil
+			}
+			// the window was entirely held back for the fade out of WithFade
+			continue
+		}
+		closed := p.closed
+		p.rwCond.L.Unlock()
+		if closed {
+			return 0, p.endErr()
+		}
+		if err := p.pullWindow(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// pullWindow reads a window of samples from the source and writes it, or writes the window read previously
+// again for a stretch envelope. At the end of the source, it flushes and closes Paulstretch.
+func (p *Paulstretch) pullWindow() error {
+	defer p.setBuffered()
+	if p.writeOff < len(p.writeBuf) {
+		n, err := io.ReadFull(p.source, p.writeBuf[p.writeOff:])
+		p.writeOff += n
+		atomic.AddInt64(&p.stats.bytesWritten, int64(n))
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				p.rwCond.L.Lock()
+				if p.closeErr == nil {
+					p.closeErr = err
+				}
+				p.rwCond.L.Unlock()
+			}
+			if p.writeOff == 0 {
+				return p.Close()
+			}
+			for i := p.writeOff; i < len(p.writeBuf); i++ {
+				p.writeBuf[i] = 0
+			}
+			p.writeOff = len(p.writeBuf)
+			p.sourceEnd = true
+		}
+	}
+	p.rwCond.L.Lock()
+	// let the window be written right away
+	p.grantPermit()
+	// the channel of the permits is closed by Close: submit then returns ErrClosed
+	p.rwCond.L.Unlock()
+	if err := p.submit(p.writeBuf); err == errNoPermit || err == ErrClosed {
+		// errNoPermit: the window is written again for a stretch envelope, once the stretched audio is read
+		return nil
+	} else if err != nil {
+		return err
+	}
+	p.writeOff = 0
+	if p.sourceEnd {
+		return p.Close()
+	}
+	return nil
+}
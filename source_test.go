@@ -0,0 +1,37 @@
+package paulstretch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+	"unsafe"
+)
+
+func TestSetSource(t *testing.T) {
+	samples := testSamples(5*testWindowSize + 9)
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	for i, opts := range [][]Option{nil, {WithChannels(2)}, {WithOutputBuffers(2)}, {WithStretchEnvelope(func(int64) float64 { return 2.5 })}} {
+		p := NewPaulstretchWithOptions(2, testWindowSize, opts...)
+		p.SetSource(iotest.HalfReader(bytes.NewReader(input)))
+		if _, err := p.Write(input); err != ErrSource {
+			t.Errorf("options %d: Write with a source: got error %v, want %v", i, err, ErrSource)
+		}
+		// all the stretched audio is pulled from the same goroutine
+		out, err := io.ReadAll(p)
+		if err != nil || len(out) < 2*len(input) {
+			t.Errorf("options %d: Read with a source: got (%d bytes, %v), want (at least %d bytes, nil)", i, len(out), err, 2*len(input))
+		}
+		if written := p.Stats().SamplesWritten; written != int64(len(samples)) {
+			t.Errorf("options %d: got %d samples written, want %d", i, written, len(samples))
+		}
+	}
+
+	errSource := errors.New("source error")
+	p := NewPaulstretch(2, testWindowSize)
+	p.SetSource(io.MultiReader(bytes.NewReader(input), iotest.ErrReader(errSource)))
+	if _, err := io.ReadAll(p); err != errSource {
+		t.Errorf("Read with a failing source: got error %v, want %v", err, errSource)
+	}
+}
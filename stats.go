@@ -0,0 +1,71 @@
+package paulstretch
+
+import "sync/atomic"
+
+// Stats are statistics about the audio processed by a Paulstretch, as returned by Paulstretch.Stats.
+type Stats struct {
+	// SamplesWritten is the number of samples written to Paulstretch.
+	SamplesWritten int64
+	// SamplesRead is the number of stretched samples read from Paulstretch.
+	SamplesRead int64
+	// WindowsProcessed is the number of full windows of samples submitted for stretching.
+	WindowsProcessed int64
+	// WriteStalls is the number of times Write or Flush blocked until Read was called, because the
+	// stretched audio was not read fast enough. Adding output buffers with WithOutputBuffers reduces it.
+	WriteStalls int64
+	// ReadStalls is the number of times Read blocked until Write or Flush was called, because
+	// no stretched audio was available.
+	ReadStalls int64
+	// SamplesSanitized is the number of samples written to Paulstretch that were replaced or clamped
+	// by WithSanitizeInput.
+	SamplesSanitized int64
+	// Underruns is the number of times Read returned silence with WithUnderrunSilence, because
+	// no stretched audio was available.
+	Underruns int64
+	// TapSamplesDropped is the number of stretched samples not copied to a writer passed to Tap, because
+	// the writer was too slow. Samples dropped for several writers are counted for each writer.
+	TapSamplesDropped int64
+}
+
+// stats holds the counters backing Stats, updated atomically.
+type stats struct {
+	bytesWritten int64
+	bytesRead    int64
+	windows      int64
+	writeStalls  int64
+	readStalls   int64
+	sanitized    int64
+	underruns    int64
+	tapDropped   int64
+	buffered     int64 // writeOff, for Buffered
+	pending      int64 // bytes of readBuf not yet read, for Pending
+	produced     int64 // stretched samples produced, for TotalOutputSamples
+}
+
+// TotalOutputSamples returns the number of stretched samples produced so far by Paulstretch, counted as they are
+// produced by the stretching, rather than as they are read: it includes the stretched samples not yet read,
+// for example those kept for the next Read when a Read is shorter than a window, so that it is exact regardless
+// of how the stretched audio is read. See Stats.SamplesRead for the samples read.
+//
+// The stretched samples held back by WithFade and WithSeamlessLoop are counted once released, and the samples
+// discarded by Prime and the silence of WithUnderrunSilence are not counted. The padding of ReadDuration is counted.
+func (p *Paulstretch) TotalOutputSamples() int64 {
+	return atomic.LoadInt64(&p.stats.produced)
+}
+
+// Stats returns statistics about the audio processed so far by Paulstretch.
+//
+// Stats can be called concurrently with Read and Write, for example to periodically report
+// the progress of a long stretch, without blocking them.
+func (p *Paulstretch) Stats() Stats {
+	return Stats{
+		SamplesWritten:    atomic.LoadInt64(&p.stats.bytesWritten) / 4,
+		SamplesRead:       atomic.LoadInt64(&p.stats.bytesRead) / 4,
+		WindowsProcessed:  atomic.LoadInt64(&p.stats.windows),
+		WriteStalls:       atomic.LoadInt64(&p.stats.writeStalls),
+		ReadStalls:        atomic.LoadInt64(&p.stats.readStalls),
+		SamplesSanitized:  atomic.LoadInt64(&p.stats.sanitized),
+		Underruns:         atomic.LoadInt64(&p.stats.underruns),
+		TapSamplesDropped: atomic.LoadInt64(&p.stats.tapDropped),
+	}
+}
@@ -0,0 +1,166 @@
+package paulstretch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// maxStretchGrow is the maximum size that Stretch allocates for its output before it is written.
+const maxStretchGrow = 1 << 26
+
+// Stretch is a utility function that stretches a complete audio sample stream (native-endian floats) at once,
+// with a stretch factor and stretching window size, and returns the complete stretched audio sample stream.
+//
+// stretchFactor and windowSize are the same as for NewPaulstretch. The end of the input is flushed, as with Flush.
+//
+// Stretch holds the whole stretched audio in memory, which is about stretchFactor times as large as the input:
+// for long inputs or high stretch factors, a Paulstretch should be used instead, to stream the stretched audio.
+func Stretch(input []byte, stretchFactor float64, windowSize int) ([]byte, error) {
+	p := NewPaulstretch(stretchFactor, windowSize)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := p.Write(input)
+		if err == nil {
+			err = p.Flush()
+		}
+		p.Close()
+		errCh <- err
+	}()
+	var out bytes.Buffer
+	// pre-grow to the expected output size, capped so that unreasonable stretch factors are not allocated
+	// (or overflow) at once: above the cap, io.Copy grows the buffer as needed
+	if size := float64(len(input)+len(p.writeBuf)) * stretchFactor; size < maxStretchGrow {
+		out.Grow(int(size))
+	} else {
+		out.Grow(maxStretchGrow)
+	}
+	_, err := io.Copy(&out, p)
+	if writeErr := <-errCh; err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// MultiStretch is a utility function that stretches an audio sample stream (native-endian floats) read from input
+// with several stretch factors in parallel, and returns one reader of the stretched audio sample
+// stream per stretch factor, in the same order as factors.
+//
+// windowSize is the same as for NewPaulstretch. input is read only once, by a goroutine that writes the
+// audio to one Paulstretch per stretch factor. When input returns EOF, the end of the input is flushed, as
+// with Flush, and the readers return EOF once all stretched audio is read. If input returns another error,
+// the readers return this error instead of EOF.
+//
+// Each Paulstretch writes until its stretched audio is read, so a slow reader throttles the reading of input
+// and all other readers: a reader that is no longer read blocks all other readers, and the goroutine
+// reading input, forever.
+//
+// The returned readers therefore also implement io.Closer, and each reader must either be read until
+// it returns an error, or be closed (with a type assertion to io.Closer) once it is no longer read.
+// Closing a reader stops the stretching for this reader, and input is no longer read once all readers are closed.
+func MultiStretch(input io.Reader, windowSize int, factors []float64) ([]io.Reader, error) {
+	if len(factors) == 0 {
+		return nil, errors.New("paulstretch: no stretch factors")
+	}
+	outputs := make([]*multiOutput, len(factors))
+	readers := make([]io.Reader, len(factors))
+	for i, factor := range factors {
+		outputs[i] = &multiOutput{p: NewPaulstretch(factor, windowSize)}
+		readers[i] = outputs[i]
+	}
+	go func() {
+		buf := make([]byte, outputs[0].p.OptimalWriteBufferSize()*4)
+		for {
+			n, err := input.Read(buf)
+			if n > 0 {
+				active := false
+				for _, o := range outputs {
+					_, err := o.p.Write(buf[:n])
+					if err == nil {
+						active = true
+					} else if err != ErrClosed {
+						// ErrClosed means that the reader was closed
+						o.p.CloseWithError(err)
+					}
+				}
+				if !active {
+					// all readers were closed
+					return
+				}
+			}
+			if err != nil {
+				for _, o := range outputs {
+					if err != io.EOF {
+						o.p.CloseWithError(err)
+					} else if err := o.p.Flush(); err != nil && err != ErrClosed {
+						o.p.CloseWithError(err)
+					} else {
+						o.p.Close()
+					}
+				}
+				return
+			}
+		}
+	}()
+	return readers, nil
+}
+
+// NewPipeline returns a reader of the audio sample stream (native-endian floats) read from input, stretched
+// with a stretch factor and stretching window size, as a single call for the most common use of Paulstretch.
+//
+// stretchFactor and windowSize are the same as for NewPaulstretch. input is read by a goroutine that writes
+// to a Paulstretch: when input returns EOF, the end of the input is flushed, as with Flush, and the reader returns
+// EOF once all stretched audio is read. If input returns another error, the reader returns this error instead of EOF.
+//
+// Closing the reader early stops the stretching: the goroutine returns after its current read of input.
+func NewPipeline(input io.Reader, stretchFactor float64, windowSize int) io.ReadCloser {
+	readers, _ := MultiStretch(input, windowSize, []float64{stretchFactor})
+	return readers[0].(*multiOutput)
+}
+
+// StretchStream is a utility function that stretches an audio sample stream (native-endian floats) read from in,
+// with a stretch factor and stretching window size, and writes the stretched audio sample stream to out,
+// for example from stdin to stdout.
+//
+// stretchFactor and windowSize are the same as for NewPaulstretch. in is read by a goroutine that writes
+// to a Paulstretch, and the end of the input is flushed, as with Flush, when in returns EOF.
+//
+// StretchStream returns the first error returned by in or out, or nil once all stretched audio is written to out.
+// On an error of out, the stretching stops, and StretchStream returns after the current read of in.
+func StretchStream(in io.Reader, out io.Writer, stretchFactor float64, windowSize int) error {
+	p := NewPaulstretch(stretchFactor, windowSize)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(p, in)
+		if err == nil {
+			err = p.Flush()
+		}
+		p.Close()
+		errCh <- err
+	}()
+	_, err := io.Copy(out, p)
+	// on an error of out, stop the goroutine, whose Write then returns ErrClosed
+	p.Close()
+	if inErr := <-errCh; err == nil {
+		// p only returns EOF once closed by the goroutine, whose error is then the first one
+		err = inErr
+	}
+	return err
+}
+
+// multiOutput is a reader of the stretched audio of a Paulstretch fed by MultiStretch, which hides its Write method.
+// The errors of the input are returned by Read once all stretched audio was read, with CloseWithError.
+type multiOutput struct {
+	p *Paulstretch
+}
+
+func (o *multiOutput) Read(data []byte) (int, error) {
+	return o.p.Read(data)
+}
+
+func (o *multiOutput) Close() error {
+	return o.p.Close()
+}
@@ -0,0 +1,99 @@
+package paulstretch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+	"unsafe"
+)
+
+func TestStretch(t *testing.T) {
+	samples := testSamples(4 * testWindowSize)
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	for _, factor := range []float64{1, 2, 8} {
+		out, err := Stretch(input, factor, testWindowSize)
+		if err != nil {
+			t.Fatalf("factor %v: Stretch: %v", factor, err)
+		}
+		if len(out) == 0 || len(out)%4 != 0 {
+			t.Errorf("factor %v: Stretch: got %d bytes, want a non-empty multiple of 4", factor, len(out))
+		}
+	}
+}
+
+func TestNewPipeline(t *testing.T) {
+	samples := testSamples(4*testWindowSize + 7)
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+
+	r := NewPipeline(bytes.NewReader(input), 2, testWindowSize)
+	out, err := io.ReadAll(r)
+	if err != nil || len(out) < 2*len(input) {
+		t.Errorf("NewPipeline: got (%d bytes, %v), want (at least %d bytes, nil)", len(out), err, 2*len(input))
+	}
+
+	errInput := errors.New("input error")
+	r = NewPipeline(io.MultiReader(bytes.NewReader(input), iotest.ErrReader(errInput)), 2, testWindowSize)
+	if _, err := io.ReadAll(r); err != errInput {
+		t.Errorf("NewPipeline with an input error: got error %v, want %v", err, errInput)
+	}
+
+	// closing early stops the stretching of an endless input
+	r = NewPipeline(iotest.HalfReader(zeroReader{}), 2, testWindowSize)
+	if _, err := io.ReadFull(r, make([]byte, 10*testWindowSize*4)); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := io.ReadAll(r); err != nil {
+		t.Errorf("NewPipeline closed early: got error %v, want nil", err)
+	}
+}
+
+// zeroReader is an endless reader of zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(data []byte) (int, error) {
+	for i := range data {
+		data[i] = 0
+	}
+	return len(data), nil
+}
+
+func TestStretchStream(t *testing.T) {
+	samples := testSamples(4*testWindowSize + 7)
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+
+	var out bytes.Buffer
+	if err := StretchStream(bytes.NewReader(input), &out, 2, testWindowSize); err != nil || out.Len() < 2*len(input) {
+		t.Errorf("StretchStream: got (%d bytes, %v), want (at least %d bytes, nil)", out.Len(), err, 2*len(input))
+	}
+
+	errInput := errors.New("input error")
+	in := io.MultiReader(bytes.NewReader(input), iotest.ErrReader(errInput))
+	if err := StretchStream(in, io.Discard, 2, testWindowSize); err != errInput {
+		t.Errorf("StretchStream with an input error: got error %v, want %v", err, errInput)
+	}
+
+	// an output error stops the stretching of an endless input
+	errOutput := errors.New("output error")
+	if err := StretchStream(zeroReader{}, &errWriter{n: 10 * testWindowSize * 4, err: errOutput}, 2, testWindowSize); err != errOutput {
+		t.Errorf("StretchStream with an output error: got error %v, want %v", err, errOutput)
+	}
+}
+
+// errWriter is a writer that discards n bytes, then returns err.
+type errWriter struct {
+	n   int
+	err error
+}
+
+func (w *errWriter) Write(data []byte) (int, error) {
+	if len(data) > w.n {
+		n := w.n
+		w.n = 0
+		return n, w.err
+	}
+	w.n -= len(data)
+	return len(data), nil
+}
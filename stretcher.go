@@ -0,0 +1,22 @@
+package paulstretch
+
+import "io"
+
+// Stretcher is the interface of the pipe-like stretching of audio of Paulstretch, for code that stretches audio
+// without depending on *Paulstretch itself, for example to substitute a fake in its tests.
+//
+// The method set is that of the common use of Paulstretch: writing audio samples, flushing their end, and reading
+// the stretched audio samples, as bytes or as samples. *Paulstretch implements Stretcher.
+type Stretcher interface {
+	io.ReadWriteCloser
+	// Flush is the same as Paulstretch.Flush.
+	Flush() error
+	// WriteSamples is the same as Paulstretch.WriteSamples.
+	WriteSamples(samples []float32) (int, error)
+	// ReadSamples is the same as Paulstretch.ReadSamples.
+	ReadSamples(samples []float32) (int, error)
+	// OptimalBufferSize is the same as Paulstretch.OptimalBufferSize.
+	OptimalBufferSize() int
+}
+
+var _ Stretcher = (*Paulstretch)(nil)
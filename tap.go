@@ -0,0 +1,102 @@
+package paulstretch
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// tapBuffers is the number of buffers of stretched audio queued for a tap, before they are dropped.
+const tapBuffers = 64
+
+// tap copies the stretched audio read from Paulstretch to a writer, on its own goroutine.
+type tap struct {
+	w      io.Writer
+	mu     sync.Mutex
+	closed bool
+	queue  chan []byte
+	free   chan []byte
+}
+
+// Tap copies all the stretched audio read from Paulstretch, as returned by Read (or TryRead), to w, in addition
+// to returning it, for example to write a debug file or meter the levels while the stretched audio is played.
+//
+// w is written to on its own goroutine, so that a slow w never blocks Read: the stretched audio is queued
+// for w, and dropped if too much of it is queued. The number of samples dropped is reported in Stats.
+// Once w returns an error, or once all stretched audio was read after Close, w is no longer written to.
+// Tap can be called several times, to copy the stretched audio to several writers.
+func (p *Paulstretch) Tap(w io.Writer) {
+	if w == nil || !p.initialized() {
+		return
+	}
+	t := &tap{
+		w:     w,
+		queue: make(chan []byte, tapBuffers),
+		free:  make(chan []byte, tapBuffers),
+	}
+	p.rwCond.L.Lock()
+	defer p.rwCond.L.Unlock()
+	if p.completed {
+		return
+	}
+	taps, _ := p.taps.Load().([]*tap)
+	p.taps.Store(append(taps[:len(taps):len(taps)], t))
+	go t.run()
+}
+
+// tap copies data, just read, to the taps.
+func (p *Paulstretch) tap(data []byte) {
+	taps, _ := p.taps.Load().([]*tap)
+	for _, t := range taps {
+		if !t.send(data) {
+			atomic.AddInt64(&p.stats.tapDropped, int64(len(data)/4))
+		}
+	}
+}
+
+// closeTaps stops the taps, at the end of the stream.
+func (p *Paulstretch) closeTaps() {
+	taps, _ := p.taps.Load().([]*tap)
+	for _, t := range taps {
+		t.mu.Lock()
+		t.closed = true
+		close(t.queue)
+		t.mu.Unlock()
+	}
+	p.taps.Store([]*tap(nil))
+}
+
+// send queues a copy of data, and returns false if it was dropped because the queue is full.
+func (t *tap) send(data []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return true
+	}
+	var buf []byte
+	select {
+	case buf = <-t.free:
+	default:
+	}
+	select {
+	case t.queue <- append(buf[:0], data...):
+		return true
+	default:
+		return false
+	}
+}
+
+// run writes the queued data to w, until the tap is closed.
+func (t *tap) run() {
+	failed := false
+	for buf := range t.queue {
+		if !failed {
+			_, err := t.w.Write(buf)
+			failed = err != nil
+		}
+		select {
+		case t.free <- buf:
+		default:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package paulstretch
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, that can block its writes.
+type syncBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	block chan struct{}
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	if b.block != nil {
+		<-b.block
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(data)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestTap(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	var taps [2]syncBuffer
+	p.Tap(&taps[0])
+	p.Tap(&taps[1])
+	done := make(chan struct{})
+	p.OnComplete(func(error) { close(done) })
+	go func() {
+		p.WriteSamples(testSamples(4 * testWindowSize))
+		p.CloseFlush()
+	}()
+	var out bytes.Buffer
+	if _, err := out.ReadFrom(p); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	<-done
+	// wait for the taps to write the queued stretched audio
+	deadline := time.Now().Add(5 * time.Second)
+	for i := range taps {
+		for !bytes.Equal(taps[i].Bytes(), out.Bytes()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Tap %d: got %d bytes, want the %d bytes read", i, len(taps[i].Bytes()), out.Len())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if n := p.Stats().TapSamplesDropped; n != 0 {
+		t.Errorf("Stats: got %d samples dropped, want 0", n)
+	}
+}
+
+func TestTapDrop(t *testing.T) {
+	p := NewPaulstretch(2, testWindowSize)
+	slow := &syncBuffer{block: make(chan struct{})}
+	defer close(slow.block)
+	p.Tap(slow)
+	go func() {
+		p.WriteSamples(testSamples(tapBuffers * testWindowSize))
+		p.CloseFlush()
+	}()
+	// a blocked tap does not block Read
+	buf := make([]byte, testWindowSize)
+	n := 0
+	for {
+		m, err := p.Read(buf)
+		n += m
+		if err != nil {
+			break
+		}
+	}
+	if got := p.Stats().TapSamplesDropped; got == 0 || got > int64(n/4) {
+		t.Errorf("Stats: got %d samples dropped, want between 1 and %d", got, n/4)
+	}
+}
@@ -0,0 +1,39 @@
+package paulstretch
+
+import "math"
+
+// StretchFactorForTempo returns the stretch factor that makes inputSamples frames (samples per channel) of audio
+// at a sample rate in Hz last a number of beats at a tempo in beats per minute, for example to stretch a one-bar
+// loop to exactly fill several bars.
+//
+// The factor is exact, but Paulstretch outputs a whole number of windows, see EstimateOutputSamples:
+// when the stretched length does not divide evenly into windows, the stretched audio is up to a window longer
+// than the requested beats, and should be truncated to BeatsToSamples(sampleRate, bpm, beats) frames.
+// The factor is less than 1 if the input already lasts longer than the beats, and NaN or infinite for
+// invalid arguments, which NewPaulstretchChecked rejects.
+func StretchFactorForTempo(inputSamples int64, sampleRate int, bpm float64, beats float64) float64 {
+	return BeatsToSamples(sampleRate, bpm, beats) / float64(inputSamples)
+}
+
+// BeatsToSamples returns the number of frames (samples per channel) lasting a number of beats at a tempo
+// in beats per minute, for audio at a sample rate in Hz. The result is not rounded: its fractional part
+// is that of the last frame.
+func BeatsToSamples(sampleRate int, bpm float64, beats float64) float64 {
+	return beats * 60 / bpm * float64(sampleRate)
+}
+
+// NewPaulstretchForTempo is like NewPaulstretchWithOptions, with the stretch factor returned by
+// StretchFactorForTempo for the other arguments, validated as with NewPaulstretchChecked.
+//
+// NewPaulstretchForTempo returns ErrInvalidStretchFactor if the input already lasts longer than the beats,
+// or if the arguments are invalid, and ErrInvalidWindowSize if windowSize is less than 128.
+func NewPaulstretchForTempo(inputSamples int64, sampleRate int, bpm float64, beats float64, windowSize int, opts ...Option) (*Paulstretch, error) {
+	factor := StretchFactorForTempo(inputSamples, sampleRate, bpm, beats)
+	if !(factor >= 1) || math.IsInf(factor, 1) {
+		return nil, ErrInvalidStretchFactor
+	}
+	if windowSize < minWindowSize {
+		return nil, ErrInvalidWindowSize
+	}
+	return NewPaulstretchWithOptions(factor, windowSize, opts...), nil
+}
@@ -0,0 +1,41 @@
+package paulstretch
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestStretchFactorForTempo(t *testing.T) {
+	// a bar of 4 beats at 120 BPM lasts 2 seconds: stretch it to 4 bars
+	if f := StretchFactorForTempo(88200, 44100, 120, 16); math.Abs(f-4) > 1e-12 {
+		t.Errorf("StretchFactorForTempo: got %v, want 4", f)
+	}
+	if n := BeatsToSamples(44100, 90, 3); math.Abs(n-88200) > 1e-9 {
+		t.Errorf("BeatsToSamples: got %v, want 88200", n)
+	}
+
+	p, err := NewPaulstretchForTempo(88200, 44100, 120, 16, testWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := p.Parameters().StretchFactor; math.Abs(f-4) > 1e-12 {
+		t.Errorf("NewPaulstretchForTempo: got stretch factor %v, want 4", f)
+	}
+	p.Close()
+	for _, tc := range []struct {
+		inputSamples int64
+		bpm          float64
+		windowSize   int
+		err          error
+	}{
+		{88200, 240, testWindowSize, ErrInvalidStretchFactor},
+		{0, 120, testWindowSize, ErrInvalidStretchFactor},
+		{88200, 0, testWindowSize, ErrInvalidStretchFactor},
+		{88200, 120, 64, ErrInvalidWindowSize},
+	} {
+		if _, err := NewPaulstretchForTempo(tc.inputSamples, 44100, tc.bpm, 4, tc.windowSize); !errors.Is(err, tc.err) {
+			t.Errorf("NewPaulstretchForTempo(%d, 44100, %v, 4, %d): got error %v, want %v", tc.inputSamples, tc.bpm, tc.windowSize, err, tc.err)
+		}
+	}
+}
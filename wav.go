@@ -0,0 +1,207 @@
+package paulstretch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// WAVFormat is the format of the samples of a WAV stream written by WAVWriter.
+type WAVFormat int
+
+const (
+	// WAVFloat32 stores samples as 32-bit IEEE floats, as stretched by Paulstretch.
+	WAVFloat32 WAVFormat = iota
+	// WAVPCM16 stores samples as 16-bit signed integers, clamping them to [-1, 1].
+	WAVPCM16
+)
+
+// wavFactOffset is the offset of the number of frames in the fact chunk of a WAV stream of WAVFloat32.
+const wavFactOffset = 46
+
+// errWAVClosed is returned by WAVWriter.Write once closed.
+var errWAVClosed = errors.New("paulstretch: WAVWriter closed")
+
+// maxWAVData is the maximum size of the data of a WAV stream, whose sizes are 32-bit.
+const maxWAVData = math.MaxUint32 - 64
+
+// WAVWriter is an io.WriteCloser that writes an audio sample stream (native-endian floats, as read from
+// Paulstretch or a reader returned by NewPipeline) to a WAV stream, incrementally, so that stretched audio
+// of any length can be written without knowing its length in advance, for example with io.Copy.
+//
+// WAVWriter first writes a header with placeholder sizes, then the samples as they are written, and seeks back
+// to patch the sizes of the header on Close. A WAV stream holds at most 4 GiB of samples, which is more than
+// 3 hours of stereo audio at 44.1 kHz with WAVFloat32: Write returns an error past this size.
+type WAVWriter struct {
+	w          io.WriteSeeker
+	format     WAVFormat
+	channels   int
+	start      int64 // offset of the header in w
+	headerSize int64
+	size       int64  // bytes of samples written to w, after the header
+	partial    []byte // bytes of an incomplete sample, not yet written
+	buf        []byte
+	dither     *ditherer
+	err        error // error returned by Write, errWAVClosed once closed
+}
+
+// NewWAVWriter returns a WAVWriter of audio of a number of channels, at a sample rate in Hz, whose samples
+// are written to w in a format, starting at the current offset of w.
+//
+// NewWAVWriter writes the header of the WAV stream right away, and returns ErrNotSeekable if w cannot seek,
+// for example if w is a pipe, since the sizes of the header could then not be patched on Close.
+func NewWAVWriter(w io.WriteSeeker, sampleRate int, channels int, format WAVFormat) (*WAVWriter, error) {
+	if (format != WAVFloat32 && format != WAVPCM16) || sampleRate <= 0 || channels <= 0 {
+		return nil, errors.New("paulstretch: invalid WAV parameters")
+	}
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, ErrNotSeekable
+	}
+	ww := &WAVWriter{
+		w:        w,
+		format:   format,
+		channels: channels,
+		start:    start,
+		partial:  make([]byte, 0, 4),
+	}
+	if _, err := w.Write(ww.header(sampleRate)); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+// header returns the header of the WAV stream, with placeholder sizes, patched on Close.
+func (w *WAVWriter) header(sampleRate int) []byte {
+	tag, bits, fmtSize := uint16(3), 32, uint32(18)
+	if w.format == WAVPCM16 {
+		tag, bits, fmtSize = 1, 16, 16
+	}
+	var h bytes.Buffer
+	put := func(fields ...interface{}) {
+		for _, f := range fields {
+			if s, ok := f.(string); ok {
+				h.WriteString(s)
+			} else {
+				binary.Write(&h, binary.LittleEndian, f)
+			}
+		}
+	}
+	put("RIFF", uint32(0), "WAVE")
+	put("fmt ", fmtSize, tag, uint16(w.channels), uint32(sampleRate))
+	put(uint32(sampleRate*w.channels*bits/8), uint16(w.channels*bits/8), uint16(bits))
+	if w.format == WAVFloat32 {
+		// non-PCM formats have an extension size, and a fact chunk with the number of frames
+		put(uint16(0), "fact", uint32(4), uint32(0))
+	}
+	put("data", uint32(0))
+	w.headerSize = int64(h.Len())
+	return h.Bytes()
+}
+
+// Write writes bytes of an audio sample stream (native-endian floats) to the WAV stream. The bytes of a sample
+// can be split across several calls to Write.
+func (w *WAVWriter) Write(data []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(data)
+	if len(w.partial) > 0 {
+		c := copy(w.partial[len(w.partial):4], data)
+		w.partial = w.partial[:len(w.partial)+c]
+		data = data[c:]
+		if len(w.partial) < 4 {
+			return n, nil
+		}
+		if err := w.write(w.partial); err != nil {
+			return 0, err
+		}
+		w.partial = w.partial[:0]
+	}
+	whole := len(data) &^ 3
+	if err := w.write(data[:whole]); err != nil {
+		return n - len(data), err
+	}
+	w.partial = append(w.partial[:0], data[whole:]...)
+	return n, nil
+}
+
+// write converts whole samples to the format of the WAV stream and writes them.
+func (w *WAVWriter) write(samples []byte) error {
+	size := len(samples)
+	if w.format == WAVPCM16 {
+		size /= 2
+	}
+	if w.size+int64(size) > maxWAVData {
+		w.err = errors.New("paulstretch: WAV stream too large")
+		return w.err
+	}
+	if cap(w.buf) < size {
+		w.buf = make([]byte, size)
+	}
+	buf := w.buf[:size]
+	for i := 0; i < len(samples); i += 4 {
+		v := math.Float32frombits(nativeOrder.Uint32(samples[i:]))
+		if w.format == WAVPCM16 {
+			f := math.Max(-1, math.Min(1, float64(v))) * math.MaxInt16
+			if w.dither != nil {
+				f += w.dither.next()
+			}
+			s := math.Max(-math.MaxInt16-1, math.Min(math.MaxInt16, math.Round(f)))
+			binary.LittleEndian.PutUint16(buf[i/2:], uint16(int16(s)))
+		} else {
+			binary.LittleEndian.PutUint32(buf[i:], math.Float32bits(v))
+		}
+	}
+	_, err := w.w.Write(buf)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.size += int64(size)
+	return nil
+}
+
+// SetDither sets the kind of dither added to the samples before they are quantized with WAVPCM16, by default
+// DitherNone: see WithDither. It has no effect with WAVFloat32, and applies to the samples written afterwards.
+func (w *WAVWriter) SetDither(kind DitherKind) {
+	w.dither = newDitherer(kind)
+}
+
+// Close patches the sizes of the header of the WAV stream, and moves the offset of the underlying writer back
+// to the end of the WAV stream. It does not close the underlying writer.
+//
+// The bytes of a last, incomplete sample are discarded. Close returns any error of the underlying writer.
+func (w *WAVWriter) Close() error {
+	if w.err == errWAVClosed {
+		return nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errWAVClosed
+	patch := func(offset int64, v uint32) error {
+		if _, err := w.w.Seek(w.start+offset, io.SeekStart); err != nil {
+			return err
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], v)
+		_, err := w.w.Write(b[:])
+		return err
+	}
+	if err := patch(4, uint32(w.headerSize-8+w.size)); err != nil {
+		return err
+	}
+	if w.format == WAVFloat32 {
+		if err := patch(wavFactOffset, uint32(w.size/int64(4*w.channels))); err != nil {
+			return err
+		}
+	}
+	if err := patch(w.headerSize-4, uint32(w.size)); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(w.start+w.headerSize+w.size, io.SeekStart)
+	return err
+}
@@ -0,0 +1,111 @@
+package paulstretch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	data []byte
+	off  int64
+}
+
+func (b *seekBuffer) Write(data []byte) (int, error) {
+	if end := b.off + int64(len(data)); end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+	copy(b.data[b.off:], data)
+	b.off += int64(len(data))
+	return len(data), nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.off
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	b.off = offset
+	return offset, nil
+}
+
+func TestWAVWriter(t *testing.T) {
+	samples := []float32{0, 0.5, -0.5, 1, -2, 0.25}
+	input := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	for _, tc := range []struct {
+		name       string
+		format     WAVFormat
+		tag        uint16
+		headerSize int
+		want       []byte
+	}{
+		{"float32", WAVFloat32, 3, 58, func() []byte {
+			var b bytes.Buffer
+			for _, v := range samples {
+				binary.Write(&b, binary.LittleEndian, math.Float32bits(v))
+			}
+			return b.Bytes()
+		}()},
+		{"pcm16", WAVPCM16, 1, 44, func() []byte {
+			var b bytes.Buffer
+			binary.Write(&b, binary.LittleEndian, []int16{0, 16384, -16384, 32767, -32767, 8192})
+			return b.Bytes()
+		}()},
+	} {
+		b := &seekBuffer{data: []byte("prefix"), off: 6}
+		w, err := NewWAVWriter(b, 44100, 2, tc.format)
+		if err != nil {
+			t.Fatalf("%s: NewWAVWriter: %v", tc.name, err)
+		}
+		// split samples across writes
+		for _, chunk := range [][]byte{input[:3], input[3:10], input[10:]} {
+			if n, err := w.Write(chunk); n != len(chunk) || err != nil {
+				t.Fatalf("%s: Write: got (%d, %v), want (%d, nil)", tc.name, n, err, len(chunk))
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", tc.name, err)
+		}
+		wav := b.data[6:]
+		if len(wav) != tc.headerSize+len(tc.want) || b.off != int64(len(b.data)) {
+			t.Fatalf("%s: got %d bytes at offset %d, want %d bytes at the end", tc.name, len(wav), b.off, tc.headerSize+len(tc.want))
+		}
+		le := binary.LittleEndian
+		if string(wav[:4]) != "RIFF" || le.Uint32(wav[4:]) != uint32(len(wav)-8) || string(wav[8:16]) != "WAVEfmt " {
+			t.Errorf("%s: invalid RIFF header %q", tc.name, wav[:16])
+		}
+		if tag, channels, rate := le.Uint16(wav[20:]), le.Uint16(wav[22:]), le.Uint32(wav[24:]); tag != tc.tag || channels != 2 || rate != 44100 {
+			t.Errorf("%s: got format (%d, %d channels, %d Hz), want (%d, 2 channels, 44100 Hz)", tc.name, tag, channels, rate, tc.tag)
+		}
+		if tc.format == WAVFloat32 && (string(wav[38:42]) != "fact" || le.Uint32(wav[wavFactOffset:]) != 3) {
+			t.Errorf("%s: got fact chunk %q with %d frames, want 3 frames", tc.name, wav[38:42], le.Uint32(wav[wavFactOffset:]))
+		}
+		data := wav[tc.headerSize-8:]
+		if string(data[:4]) != "data" || le.Uint32(data[4:]) != uint32(len(tc.want)) || !bytes.Equal(data[8:], tc.want) {
+			t.Errorf("%s: got data chunk %v, want %d bytes %v", tc.name, data, len(tc.want), tc.want)
+		}
+	}
+}
+
+func TestWAVWriterNotSeekable(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := NewWAVWriter(w, 44100, 1, WAVFloat32); err != ErrNotSeekable {
+		t.Errorf("NewWAVWriter with a pipe: got error %v, want %v", err, ErrNotSeekable)
+	}
+}
@@ -0,0 +1,38 @@
+package paulstretch
+
+import "math"
+
+// DefaultWindowDuration is the recommended duration, in seconds, of the stretching window, which works best
+// for most music.
+const DefaultWindowDuration = 0.25
+
+// minWindowSize is the minimum recommended window size, in samples.
+const minWindowSize = 128
+
+// WindowSizeForDuration returns a window size, in samples, suitable for NewPaulstretch, corresponding
+// to a window duration in seconds, for audio at a sample rate in Hz.
+//
+// The window size is at least 128, and is rounded up to the next size whose only prime factors are 2, 3 and 5,
+// for which FFTs are most efficient. It can therefore be slightly longer than the requested duration.
+//
+// DefaultWindowDuration is a good duration for most music.
+func WindowSizeForDuration(seconds float64, sampleRate int) int {
+	n := int(math.Ceil(seconds * float64(sampleRate)))
+	if n < minWindowSize {
+		n = minWindowSize
+	}
+	for !smooth(n) {
+		n++
+	}
+	return n
+}
+
+// smooth returns whether the only prime factors of n are 2, 3 and 5.
+func smooth(n int) bool {
+	for _, f := range []int{2, 3, 5} {
+		for n%f == 0 {
+			n /= f
+		}
+	}
+	return n == 1
+}
@@ -0,0 +1,99 @@
+package paulstretch
+
+import (
+	"runtime"
+	"sync"
+)
+
+// workerPools holds the *workerPool of each number of workers, shared by all Paulstretch instances
+// created with WithSharedWorkers.
+var workerPools sync.Map
+
+// workerPool is a set of goroutines locked to OS threads, which make the calls of the engines funneled through them.
+type workerPool struct {
+	calls chan *workerEngine
+}
+
+// sharedWorkers returns the pool of n workers, started on first use. The workers run for the lifetime of the process.
+func sharedWorkers(n int) *workerPool {
+	if pool, ok := workerPools.Load(n); ok {
+		return pool.(*workerPool)
+	}
+	pool, loaded := workerPools.LoadOrStore(n, &workerPool{calls: make(chan *workerEngine)})
+	if !loaded {
+		for i := 0; i < n; i++ {
+			go pool.(*workerPool).run()
+		}
+	}
+	return pool.(*workerPool)
+}
+
+func (w *workerPool) run() {
+	runtime.LockOSThread()
+	for e := range w.calls {
+		switch e.op {
+		case workerWrite:
+			e.e.write(e.samples)
+			e.samples = nil
+		case workerRead:
+			e.samples, e.ok = e.e.read()
+		case workerDestroy:
+			e.e.destroy()
+		}
+		e.done <- struct{}{}
+	}
+}
+
+const (
+	workerWrite = iota
+	workerRead
+	workerDestroy
+)
+
+// workerEngine is an engine whose calls are made by the workers of a pool, see WithSharedWorkers.
+//
+// The calls of an engine are never concurrent, so that the arguments and results of the call in progress
+// are stored in the engine itself, without allocating.
+type workerEngine struct {
+	e       engine
+	pool    *workerPool
+	op      int
+	samples []float32
+	ok      bool
+	done    chan struct{}
+}
+
+func newWorkerEngine(e engine, pool *workerPool) *workerEngine {
+	return &workerEngine{
+		e:    e,
+		pool: pool,
+		done: make(chan struct{}, 1),
+	}
+}
+
+// call makes a call with a worker, and waits for its completion.
+func (e *workerEngine) call(op int) {
+	e.op = op
+	e.pool.calls <- e
+	<-e.done
+}
+
+func (e *workerEngine) write(samples []float32) {
+	e.samples = samples
+	e.call(workerWrite)
+}
+
+func (e *workerEngine) read() ([]float32, bool) {
+	e.call(workerRead)
+	samples := e.samples
+	e.samples = nil
+	return samples, e.ok
+}
+
+func (e *workerEngine) latency() int {
+	return e.e.latency()
+}
+
+func (e *workerEngine) destroy() {
+	e.call(workerDestroy)
+}
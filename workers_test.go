@@ -0,0 +1,56 @@
+package paulstretch
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSharedWorkers(t *testing.T) {
+	samples := testSamples(6*testWindowSize + 5)
+	stretch := func(p *Paulstretch) []float32 {
+		return stretchAll(t, p, samples, func(s []float32) error {
+			_, err := p.WriteSamples(s)
+			return err
+		}, p.ReadSamples)
+	}
+	ref := NewPaulstretch(2, testWindowSize)
+	ref.ps[0] = &identityEngine{}
+	want := stretch(ref)
+
+	// many more instances than workers
+	var wg sync.WaitGroup
+	outs := make([][]float32, 16)
+	errs := make([]error, len(outs))
+	for i := range outs {
+		p := NewPaulstretchWithOptions(2, testWindowSize, WithSharedWorkers(2))
+		e, ok := p.ps[0].(*workerEngine)
+		if !ok {
+			t.Fatalf("WithSharedWorkers: got engine %T, want %T", p.ps[0], e)
+		}
+		e.e.destroy()
+		e.e = &identityEngine{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// stretchAll cannot be called outside of the test goroutine
+			go func() {
+				p.WriteSamples(samples)
+				p.CloseFlush()
+			}()
+			outs[i], errs[i] = readAll(p)
+		}(i)
+	}
+	wg.Wait()
+	for i, out := range outs {
+		if errs[i] != nil {
+			t.Fatalf("WithSharedWorkers: instance %d: %v", i, errs[i])
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("WithSharedWorkers: instance %d: got %d stretched samples, want the %d of an instance without workers", i, len(out), len(want))
+		}
+	}
+	if sharedWorkers(2) != sharedWorkers(2) {
+		t.Errorf("sharedWorkers: got different pools for the same number of workers")
+	}
+}